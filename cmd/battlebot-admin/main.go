@@ -0,0 +1,691 @@
+// Command battlebot-admin inspects and fixes saved players without running the bot
+// It uses the same stores as the bot, so stop the bot first or it will overwrite the changes on its next save
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jonas747/battlebot/core"
+	"github.com/jonas747/battlebot/items"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The actor in ledger transactions made with this tool
+const Actor = "battlebot-admin"
+
+type command struct {
+	Name        string
+	Usage       string
+	Description string
+	Run         func(args []string) error
+}
+
+var commands = []*command{
+	&command{Name: "list", Usage: "list [-guild id]", Description: "Lists all players, or only the ones in a servers economy", Run: runList},
+	&command{Name: "search", Usage: "search <text>", Description: "Lists players whose name or id contains text", Run: runSearch},
+	&command{Name: "show", Usage: "show [-json] <player>", Description: "Shows everything saved about a player", Run: runShow},
+	&command{Name: "set", Usage: "set <player> <money|xp|strength|stamina|agility> <value>", Description: "Changes a players money, XP or an attribute", Run: runSet},
+	&command{Name: "additem", Usage: "additem <player> <item>", Description: "Adds an item, by id or name, to a players inventory", Run: runAddItem},
+	&command{Name: "removeitem", Usage: "removeitem <player> <item>", Description: "Removes an item, by id or name, from a players inventory, unequipped ones first", Run: runRemoveItem},
+	&command{Name: "merge", Usage: "merge [-overwrite] [-kind json|bolt] <save>", Description: "Adds the players from another save, e.g a backup, that are missing from the store, -overwrite also replaces the ones in both", Run: runMerge},
+	&command{Name: "diff", Usage: "diff [-kind json|bolt] <save> [other save]", Description: "Shows the differences between the store and a save, or between two saves", Run: runDiff},
+}
+
+func main() {
+	// The store flags come before the command, the command and its arguments are what's left
+	core.ParseFlags()
+	items.RegisterGenericItems()
+
+	args := flag.Args()
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, v := range commands {
+		if v.Name == args[0] {
+			err := v.Run(args[1:])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: battlebot-admin [-store json|bolt] [-storepath path] [-ledger path] <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\nPlayers are given by id, server id/user id for players in a servers economy, or name")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, v := range commands {
+		fmt.Fprintf(os.Stderr, "  %-60s %s\n", v.Usage, v.Description)
+	}
+}
+
+var errUsage = errors.New("wrong arguments, run without a command for usage")
+
+// Parses the flags of a command and returns the arguments after them, there have to be at least min
+func parseFlags(set *flag.FlagSet, args []string, min int) ([]string, error) {
+	err := set.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if set.NArg() < min {
+		return nil, errUsage
+	}
+	return set.Args(), nil
+}
+
+func openStore() (core.Store, error) {
+	store, err := core.OpenConfiguredStore()
+	if err != nil {
+		return nil, fmt.Errorf("opening the store: %s", err)
+	}
+	return store, nil
+}
+
+// Opens the configured store without changing it, for commands that only read
+func openStoreReadOnly() (core.Store, error) {
+	store, err := core.OpenConfiguredStoreReadOnly()
+	if err != nil {
+		return nil, fmt.Errorf("opening the store: %s", err)
+	}
+	return store, nil
+}
+
+// Opens the save at path read only, unlike the configured store it has to exist
+// Saves are often backups, so older ones are migrated in memory instead of being rewritten
+func openSave(kind, path string) (core.Store, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	store, err := core.OpenStoreReadOnly(kind, path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %s", path, err)
+	}
+	return store, nil
+}
+
+// Returns the player with key or name, names have to be unique
+func findPlayer(store core.Store, query string) (*core.Player, error) {
+	p, err := store.GetPlayer(query)
+	if err != nil || p != nil {
+		return p, err
+	}
+
+	players, err := store.ListPlayers()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]*core.Player, 0)
+	for _, v := range players {
+		if strings.EqualFold(v.Name, query) {
+			matches = append(matches, v)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no player with the id or name %q", query)
+	case 1:
+		return matches[0], nil
+	}
+
+	keys := make([]string, len(matches))
+	for k, v := range matches {
+		keys[k] = v.Key()
+	}
+	sort.Strings(keys)
+	return nil, fmt.Errorf("%d players are named %q, use one of their ids: %s", len(matches), query, strings.Join(keys, ", "))
+}
+
+// Writes p to the store and then commits tx to the ledger
+func savePlayer(store core.Store, p *core.Player, tx *core.LedgerTx) error {
+	err := store.PutPlayer(p)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		tx.Commit()
+	}
+	return nil
+}
+
+func openLedger() error {
+	err := core.OpenConfiguredLedger()
+	if err != nil {
+		return fmt.Errorf("opening the ledger: %s", err)
+	}
+	return nil
+}
+
+func sortPlayers(players []*core.Player) {
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Key() < players[j].Key()
+	})
+}
+
+func printPlayers(players []*core.Player) {
+	sortPlayers(players)
+	for _, v := range players {
+		fmt.Printf("%-40s %-24s level %-4d %d$\n", v.Key(), v.Name, core.GetLevelFromXP(v.XP), v.Money)
+	}
+	fmt.Printf("%d players\n", len(players))
+}
+
+func runList(args []string) error {
+	set := flag.NewFlagSet("list", flag.ExitOnError)
+	guild := set.String("guild", "", "Only list players in the economy of this server, global for the global one")
+	_, err := parseFlags(set, args, 0)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStoreReadOnly()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	players, err := store.ListPlayers()
+	if err != nil {
+		return err
+	}
+
+	if *guild != "" {
+		filtered := make([]*core.Player, 0, len(players))
+		for _, v := range players {
+			if v.Guild == *guild || (*guild == "global" && v.Guild == "") {
+				filtered = append(filtered, v)
+			}
+		}
+		players = filtered
+	}
+
+	printPlayers(players)
+	return nil
+}
+
+func runSearch(args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	query := strings.ToLower(strings.Join(args, " "))
+
+	store, err := openStoreReadOnly()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	players, err := store.ListPlayers()
+	if err != nil {
+		return err
+	}
+
+	matches := make([]*core.Player, 0)
+	for _, v := range players {
+		if strings.Contains(strings.ToLower(v.Name), query) || strings.Contains(v.Key(), query) {
+			matches = append(matches, v)
+		}
+	}
+
+	printPlayers(matches)
+	return nil
+}
+
+func runShow(args []string) error {
+	set := flag.NewFlagSet("show", flag.ExitOnError)
+	asJSON := set.Bool("json", false, "Print the player as it's saved")
+	args, err := parseFlags(set, args, 1)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStoreReadOnly()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	p, err := findPlayer(store, args[0])
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		out, err := json.MarshalIndent(p, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	guild := p.Guild
+	if guild == "" {
+		guild = "global"
+	}
+
+	fmt.Printf("Name:       %s\n", p.Name)
+	fmt.Printf("Id:         %s\n", p.Id)
+	fmt.Printf("Economy:    %s\n", guild)
+	fmt.Printf("Language:   %s\n", p.Language)
+	fmt.Printf("Level:      %d (%d XP)\n", core.GetLevelFromXP(p.XP), p.XP)
+	fmt.Printf("Money:      %d$\n", p.Money)
+	fmt.Printf("Battles:    %d won, %d lost, %d in history\n", p.Wins, p.Losses, len(p.History))
+	fmt.Printf("Attributes: strength %d, stamina %d, agility %d (%d points unused)\n",
+		p.Attributes.Get(core.AttributeStrength), p.Attributes.Get(core.AttributeStamina), p.Attributes.Get(core.AttributeAgility), p.AvailableAttributePoints())
+
+	fmt.Printf("Inventory:  %d items\n", len(p.Inventory))
+	for k, v := range p.Inventory {
+		name := "unknown item"
+		if itemType := core.GetItemTypeById(v.Id); itemType != nil {
+			name = itemType.Name
+		}
+
+		equipped := ""
+		if v.EquipmentSlot != core.EquipmentSlotNone {
+			equipped = " (equipped as " + v.EquipmentSlot.String() + ")"
+		}
+		fmt.Printf("  [%d] %s (id: %d)%s\n", k, name, v.Id, equipped)
+	}
+	return nil
+}
+
+// Returns the attribute with name, matching the choices of the up command
+func findAttribute(name string) (core.AttributeType, bool) {
+	for _, v := range core.AttributeChoices {
+		if strings.EqualFold(v.Name, name) {
+			return v.Value.(core.AttributeType), true
+		}
+		for _, alias := range v.Aliases {
+			if strings.EqualFold(alias, name) {
+				return v.Value.(core.AttributeType), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func runSet(args []string) error {
+	if len(args) < 3 {
+		return errUsage
+	}
+
+	value, err := strconv.Atoi(args[2])
+	if err != nil || value < 0 {
+		return fmt.Errorf("%q isn't a number of 0 or more", args[2])
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	p, err := findPlayer(store, args[0])
+	if err != nil {
+		return err
+	}
+
+	var tx *core.LedgerTx
+	field := strings.ToLower(args[1])
+	switch field {
+	case "money":
+		err = openLedger()
+		if err != nil {
+			return err
+		}
+		defer core.Ledger.Close()
+
+		fmt.Printf("%s: money %d -> %d\n", p.Name, p.Money, value)
+		tx = core.Ledger.Begin(core.ReasonEdit, Actor)
+		tx.AddMoney(p, value-p.Money)
+	case "xp":
+		fmt.Printf("%s: XP %d -> %d (level %d -> %d)\n", p.Name, p.XP, value, core.GetLevelFromXP(p.XP), core.GetLevelFromXP(value))
+		p.XP = value
+	default:
+		attribute, ok := findAttribute(field)
+		if !ok {
+			return fmt.Errorf("unknown field %q, use money, xp, strength, stamina or agility", args[1])
+		}
+
+		fmt.Printf("%s: %s %d -> %d\n", p.Name, attribute, p.Attributes.Get(attribute), value)
+		p.Attributes.Set(attribute, value)
+		if p.AvailableAttributePoints() < 0 {
+			fmt.Printf("Warning: %s now uses %d more attribute points than their level gives\n", p.Name, -p.AvailableAttributePoints())
+		}
+	}
+
+	return savePlayer(store, p, tx)
+}
+
+func runAddItem(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	itemType, err := core.FindItemType(strings.Join(args[1:], " "))
+	if err != nil {
+		return errors.New(core.LocalizeError(core.FallbackLanguage, err))
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	p, err := findPlayer(store, args[0])
+	if err != nil {
+		return err
+	}
+
+	err = openLedger()
+	if err != nil {
+		return err
+	}
+	defer core.Ledger.Close()
+
+	tx := core.Ledger.Begin(core.ReasonEdit, Actor)
+	tx.AddItem(p, itemType.Id)
+	fmt.Printf("Added %s (id: %d) to %s, inventory slot %d\n", itemType.Name, itemType.Id, p.Name, len(p.Inventory)-1)
+	return savePlayer(store, p, tx)
+}
+
+func runRemoveItem(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	itemType, err := core.FindItemType(strings.Join(args[1:], " "))
+	if err != nil {
+		return errors.New(core.LocalizeError(core.FallbackLanguage, err))
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	p, err := findPlayer(store, args[0])
+	if err != nil {
+		return err
+	}
+
+	slot := -1
+	for k, v := range p.Inventory {
+		if v.Id != itemType.Id {
+			continue
+		}
+		if slot == -1 || v.EquipmentSlot == core.EquipmentSlotNone {
+			slot = k
+		}
+		if v.EquipmentSlot == core.EquipmentSlotNone {
+			break
+		}
+	}
+	if slot == -1 {
+		return fmt.Errorf("%s doesn't have %s (id: %d)", p.Name, itemType.Name, itemType.Id)
+	}
+
+	err = openLedger()
+	if err != nil {
+		return err
+	}
+	defer core.Ledger.Close()
+
+	tx := core.Ledger.Begin(core.ReasonEdit, Actor)
+	tx.TakeItem(p, slot)
+	fmt.Printf("Removed %s (id: %d) from %s, it was in inventory slot %d\n", itemType.Name, itemType.Id, p.Name, slot)
+	return savePlayer(store, p, tx)
+}
+
+func runMerge(args []string) error {
+	set := flag.NewFlagSet("merge", flag.ExitOnError)
+	overwrite := set.Bool("overwrite", false, "Replace players that are in both with the ones from the other save")
+	kind := set.String("kind", "json", "Kind of the other save: json or bolt")
+	args, err := parseFlags(set, args, 1)
+	if err != nil {
+		return err
+	}
+
+	other, err := openSave(*kind, args[0])
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	err = openLedger()
+	if err != nil {
+		return err
+	}
+	defer core.Ledger.Close()
+
+	result, err := mergePlayers(store, other, *overwrite)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d added, %d replaced, %d kept, %d already the same\n", result.Added, result.Replaced, result.Kept, result.Same)
+	return nil
+}
+
+// How many players mergePlayers added, replaced, kept because they differ and skipped because they're the same
+type mergeResult struct {
+	Added, Replaced, Kept, Same int
+}
+
+// Adds the players in other that are missing from store, overwrite also replaces the ones that differ
+// The changes are recorded in the ledger once they're saved
+func mergePlayers(store, other core.Store, overwrite bool) (*mergeResult, error) {
+	incoming, err := other.ListPlayers()
+	if err != nil {
+		return nil, err
+	}
+	sortPlayers(incoming)
+
+	var result mergeResult
+	txs := make([]*core.LedgerTx, 0)
+	err = store.Update(func(storeTx core.StoreTx) error {
+		for _, v := range incoming {
+			existing, err := storeTx.GetPlayer(v.Key())
+			if err != nil {
+				return err
+			}
+
+			if existing != nil {
+				if samePlayer(existing, v) {
+					result.Same++
+					continue
+				}
+
+				if !overwrite {
+					result.Kept++
+					fmt.Printf("Kept %s (%s), it's different in the store\n", v.Key(), v.Name)
+					continue
+				}
+			}
+
+			err = storeTx.PutPlayer(v)
+			if err != nil {
+				return err
+			}
+
+			if existing == nil {
+				result.Added++
+				fmt.Printf("Added %s (%s)\n", v.Key(), v.Name)
+			} else {
+				result.Replaced++
+				fmt.Printf("Replaced %s (%s)\n", v.Key(), v.Name)
+			}
+
+			tx := core.Ledger.Begin(core.ReasonMerge, Actor)
+			tx.RecordReplace(existing, v)
+			txs = append(txs, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only recorded once the players are saved
+	for _, v := range txs {
+		v.Commit()
+	}
+	return &result, nil
+}
+
+func samePlayer(a, b *core.Player) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+func runDiff(args []string) error {
+	set := flag.NewFlagSet("diff", flag.ExitOnError)
+	kind := set.String("kind", "json", "Kind of the saves given as arguments: json or bolt")
+	args, err := parseFlags(set, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var a, b core.Store
+	nameA, nameB := "store", args[0]
+	if len(args) > 1 {
+		nameA, nameB = args[0], args[1]
+		a, err = openSave(*kind, nameA)
+	} else {
+		a, err = openStoreReadOnly()
+	}
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	b, err = openSave(*kind, nameB)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	playersA, err := playerMaps(a)
+	if err != nil {
+		return err
+	}
+	playersB, err := playerMaps(b)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(playersA)+len(playersB))
+	for k := range playersA {
+		keys = append(keys, k)
+	}
+	for k := range playersB {
+		if _, ok := playersA[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	differences := 0
+	for _, key := range keys {
+		pa, inA := playersA[key]
+		pb, inB := playersB[key]
+		switch {
+		case !inB:
+			fmt.Printf("%s (%v): only in %s\n", key, pa["Name"], nameA)
+		case !inA:
+			fmt.Printf("%s (%v): only in %s\n", key, pb["Name"], nameB)
+		default:
+			fields := diffFields(pa, pb)
+			if len(fields) < 1 {
+				continue
+			}
+
+			fmt.Printf("%s (%v):\n", key, pa["Name"])
+			for _, field := range fields {
+				fmt.Printf("  %s: %s -> %s\n", field, compact(pa[field]), compact(pb[field]))
+			}
+		}
+		differences++
+	}
+
+	fmt.Printf("%d of %d players differ between %s and %s\n", differences, len(keys), nameA, nameB)
+	return nil
+}
+
+// Returns the players in store as generic json by key, so every saved field can be compared
+func playerMaps(store core.Store) (map[string]map[string]interface{}, error) {
+	players, err := store.ListPlayers()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]map[string]interface{})
+	for _, v := range players {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		var decoded map[string]interface{}
+		err = json.Unmarshal(data, &decoded)
+		if err != nil {
+			return nil, err
+		}
+		out[v.Key()] = decoded
+	}
+	return out, nil
+}
+
+// Returns the names of the fields that differ between a and b, sorted
+func diffFields(a, b map[string]interface{}) []string {
+	out := make([]string, 0)
+	for k, v := range a {
+		if !reflect.DeepEqual(v, b[k]) {
+			out = append(out, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func compact(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
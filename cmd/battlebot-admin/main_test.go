@@ -0,0 +1,148 @@
+package main
+
+import (
+	"github.com/jonas747/battlebot/core"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffFields(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b map[string]interface{}
+		want []string
+	}{
+		{
+			name: "same",
+			a:    map[string]interface{}{"Name": "alice", "Money": 10.0},
+			b:    map[string]interface{}{"Name": "alice", "Money": 10.0},
+			want: []string{},
+		},
+		{
+			name: "changed",
+			a:    map[string]interface{}{"Name": "alice", "Money": 10.0, "XP": 5.0},
+			b:    map[string]interface{}{"Name": "alice", "Money": 20.0, "XP": 6.0},
+			want: []string{"Money", "XP"},
+		},
+		{
+			name: "only in one",
+			a:    map[string]interface{}{"Name": "alice", "Guild": "1"},
+			b:    map[string]interface{}{"Name": "alice", "Language": "fr"},
+			want: []string{"Guild", "Language"},
+		},
+		{
+			name: "nested",
+			a:    map[string]interface{}{"Inventory": []interface{}{map[string]interface{}{"Id": 1.0}}},
+			b:    map[string]interface{}{"Inventory": []interface{}{map[string]interface{}{"Id": 2.0}}},
+			want: []string{"Inventory"},
+		},
+		{
+			name: "null and missing",
+			a:    map[string]interface{}{"History": nil},
+			b:    map[string]interface{}{},
+			want: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		got := diffFields(c.a, c.b)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSamePlayer(t *testing.T) {
+	a := &core.Player{Id: "1", Name: "alice", Money: 10, Inventory: []*core.PlayerItem{{Id: 1}}}
+	b := &core.Player{Id: "1", Name: "alice", Money: 10, Inventory: []*core.PlayerItem{{Id: 1}}}
+	if !samePlayer(a, b) {
+		t.Error("identical players aren't the same")
+	}
+
+	b.Inventory[0].Id = 2
+	if samePlayer(a, b) {
+		t.Error("players with different items are the same")
+	}
+}
+
+func openTestStore(t *testing.T, name string, players ...*core.Player) core.Store {
+	store, err := core.OpenJSONStore(filepath.Join(t.TempDir(), name), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range players {
+		err = store.PutPlayer(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestMergePlayers(t *testing.T) {
+	err := core.Ledger.Open(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer core.Ledger.Close()
+
+	for _, overwrite := range []bool{false, true} {
+		store := openTestStore(t, "players.json",
+			&core.Player{Id: "1", Name: "alice", Money: 10},
+			&core.Player{Id: "2", Name: "bob", Money: 20},
+		)
+		other := openTestStore(t, "backup.json",
+			&core.Player{Id: "1", Name: "alice", Money: 10},
+			&core.Player{Id: "2", Name: "bob", Money: 50},
+			&core.Player{Id: "3", Name: "carol", Money: 30},
+			&core.Player{Id: "3", Guild: "9", Name: "carol", Money: 5},
+		)
+
+		result, err := mergePlayers(store, other, overwrite)
+		if err != nil {
+			t.Fatal("mergePlayers:", err)
+		}
+
+		want := &mergeResult{Added: 2, Kept: 1, Same: 1}
+		bobMoney := 20
+		if overwrite {
+			want = &mergeResult{Added: 2, Replaced: 1, Same: 1}
+			bobMoney = 50
+		}
+		if *result != *want {
+			t.Errorf("overwrite %t: got %+v, want %+v", overwrite, result, want)
+		}
+
+		bob, err := store.GetPlayer("2")
+		if err != nil || bob == nil {
+			t.Fatalf("overwrite %t: bob is missing: %v", overwrite, err)
+		}
+		if bob.Money != bobMoney {
+			t.Errorf("overwrite %t: bob has %d$, want %d$", overwrite, bob.Money, bobMoney)
+		}
+
+		for _, key := range []string{"3", "9/3"} {
+			p, err := store.GetPlayer(key)
+			if err != nil || p == nil {
+				t.Errorf("overwrite %t: %s wasn't added: %v", overwrite, key, err)
+				continue
+			}
+
+			history, err := core.Ledger.PlayerHistory(p)
+			if err != nil || len(history) < 1 {
+				t.Errorf("overwrite %t: adding %s wasn't recorded in the ledger: %v", overwrite, key, err)
+			}
+		}
+
+		// Merging again changes nothing
+		result, err = mergePlayers(store, other, overwrite)
+		if err != nil {
+			t.Fatal("merging again:", err)
+		}
+		if result.Added != 0 || result.Replaced != 0 {
+			t.Errorf("overwrite %t: merging again changed players: %+v", overwrite, result)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+// Command battlebot-repl lets you play battlebot from a terminal without connecting to discord
+// Every line is handled as a command from the current fake user, lines starting with / control the repl
+// Players, the ledger and guild settings are kept in a temporary directory unless it's started with -persist
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	_ "github.com/jonas747/battlebot/commands"
+	"github.com/jonas747/battlebot/core"
+	"github.com/jonas747/battlebot/items"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	LocalChannel = "local"
+	LocalGuild   = "local"
+)
+
+var (
+	transport *core.MemoryTransport
+	current   *discordgo.User
+	channel   = LocalChannel
+	lastID    = 100
+	lastMsgID = 0
+
+	flagPersist bool
+)
+
+func main() {
+	flag.BoolVar(&flagPersist, "persist", false, "Use the bots players store, ledger and guild settings instead of throwaway ones, the players are loaded first")
+	core.ParseFlags()
+	items.RegisterGenericItems()
+
+	transport = core.NewMemoryTransport(&discordgo.User{ID: "1", Username: "BattleBot", Bot: true})
+	transport.OnMessage = printMessage
+	core.SetTransport(transport)
+
+	go core.Battles.Run()
+
+	dir := ""
+	if !flagPersist {
+		// Keep everything in a temporary directory so playing around never touches the bots saves
+		var err error
+		dir, err = ioutil.TempDir("", "battlebot-repl")
+		if err != nil {
+			fmt.Println("Failed creating a temporary directory:", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(dir)
+		core.GuildsFile = filepath.Join(dir, "guilds.json")
+	}
+
+	err := core.Guilds.Load()
+	if err != nil {
+		fmt.Println("Failed loading guild settings:", err)
+	}
+	core.LoadLanguageDir()
+
+	err = openSaves(dir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	current = getCreateUser("player")
+
+	fmt.Println(core.VERSION + " local repl, type /help for repl commands")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print(current.Username + "> ")
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			if !handleReplCommand(line) {
+				break
+			}
+			continue
+		}
+
+		m := createMessage(line)
+		err := core.HandleCommand(m.Content, m)
+		if err != nil {
+			fmt.Println("Error: " + core.LocalizeError(core.LanguageFor(m.Author.ID, m.GuildID), err))
+		}
+	}
+
+	// Same as the bot on SIGINT or SIGTERM: finish battles, save and close the store
+	err = core.Shutdown()
+	if err != nil {
+		fmt.Println("Shut down with errors:", err)
+	}
+}
+
+// Opens a players store and ledger in dir, or the bots ones if dir is empty
+func openSaves(dir string) error {
+	var err error
+	if dir == "" {
+		core.Players.Store, err = core.OpenConfiguredStore()
+	} else {
+		core.Players.Store, err = core.OpenStore("json", filepath.Join(dir, "players.json"))
+	}
+	if err != nil {
+		return fmt.Errorf("Failed opening the store: %s", err)
+	}
+
+	if dir == "" {
+		err = core.OpenConfiguredLedger()
+	} else {
+		err = core.Ledger.Open(filepath.Join(dir, "ledger.jsonl"))
+	}
+	if err != nil {
+		return fmt.Errorf("Failed opening the ledger: %s", err)
+	}
+
+	if dir == "" {
+		// Saving on quit writes every player in memory, so start from the saved ones
+		err = loadPlayers()
+		if err != nil {
+			return fmt.Errorf("Failed loading players: %s", err)
+		}
+	}
+	return nil
+}
+
+// Loads the players from the store and adds a fake user for each
+func loadPlayers() error {
+	err := core.Players.Load()
+	if err != nil {
+		return err
+	}
+
+	core.Players.RLock()
+	for _, v := range core.Players.Players {
+		if _, err := transport.User(v.Id); err != nil {
+			transport.AddUser(&discordgo.User{ID: v.Id, Username: v.Name})
+		}
+	}
+	core.Players.RUnlock()
+	return nil
+}
+
+// Returns false if the repl should quit
+func handleReplCommand(line string) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "/quit", "/exit", "/q":
+		return false
+	case "/as":
+		if len(fields) < 2 {
+			fmt.Println("Usage: /as <name>")
+			break
+		}
+		current = getCreateUser(strings.Join(fields[1:], " "))
+	case "/admin":
+		if len(fields) < 2 {
+			fmt.Println("Usage: /admin <name>")
+			break
+		}
+		user := getCreateUser(fields[1])
+		transport.Lock()
+		transport.Permissions[user.ID] ^= discordgo.PermissionAdministrator
+		isAdmin := transport.Permissions[user.ID]&discordgo.PermissionAdministrator != 0
+		transport.Unlock()
+		fmt.Printf("%s admin: %t\n", user.Username, isAdmin)
+	case "/role":
+		if len(fields) < 3 {
+			fmt.Println("Usage: /role <name> <role id>")
+			break
+		}
+		user := getCreateUser(fields[1])
+		transport.Lock()
+		roles := transport.Roles[user.ID]
+		hasRole := false
+		for k, v := range roles {
+			if v == fields[2] {
+				roles = append(roles[:k], roles[k+1:]...)
+				hasRole = true
+				break
+			}
+		}
+		if !hasRole {
+			roles = append(roles, fields[2])
+		}
+		transport.Roles[user.ID] = roles
+		transport.Unlock()
+		fmt.Printf("%s has role %s: %t\n", user.Username, fields[2], !hasRole)
+	case "/channel":
+		if len(fields) < 2 {
+			fmt.Println("Current channel:", channel)
+			break
+		}
+		channel = fields[1]
+	case "/press":
+		if len(fields) < 2 {
+			fmt.Println("Usage: /press <button id>")
+			break
+		}
+		pressButton(fields[1])
+	case "/users":
+		transport.RLock()
+		for _, v := range transport.Users {
+			fmt.Printf("%s (%s)\n", v.Username, v.ID)
+		}
+		transport.RUnlock()
+	case "/load":
+		err := loadPlayers()
+		if err != nil {
+			fmt.Println("Failed loading:", err)
+			break
+		}
+		fmt.Println("Loaded players")
+	case "/save":
+		err := core.Players.Save()
+		if err != nil {
+			fmt.Println("Failed saving:", err)
+			break
+		}
+		fmt.Println("Saved players")
+	case "/help":
+		fmt.Println("Lines not starting with / are sent as commands, e.g `battle @bob 5` or `help`")
+		fmt.Println("/as <name>    - Switch to (and create if needed) a fake user")
+		fmt.Println("/admin <name> - Toggle server admin permissions for a fake user")
+		fmt.Println("/role <name> <id> - Toggle a role for a fake user")
+		fmt.Println("/channel <id> - Switch to another channel in the local server, use numeric ids to mention them in commands")
+		fmt.Println("/press <id>   - Press a button as the current user, ids are shown next to messages")
+		fmt.Println("/users        - List fake users")
+		fmt.Println("/load         - Load players from the store (the bots one with -persist, see -store and -storepath)")
+		fmt.Println("/save         - Save the changed players to the store")
+		fmt.Println("/quit         - Finish battles, save and exit")
+	default:
+		fmt.Println("Unknown repl command, see /help")
+	}
+	return true
+}
+
+func pressButton(customID string) {
+	m := createMessage("")
+	err := core.HandleComponent(m, nil, customID)
+	if err != nil {
+		fmt.Println("Error: " + core.LocalizeError(core.LanguageFor(m.Author.ID, m.GuildID), err))
+	}
+}
+
+func getCreateUser(name string) *discordgo.User {
+	user, err := transport.FindMember(LocalChannel, name)
+	if err == nil {
+		return user
+	}
+
+	lastID++
+	user = &discordgo.User{
+		ID:       strconv.Itoa(lastID),
+		Username: name,
+	}
+	transport.AddUser(user)
+	return user
+}
+
+// Creates a synthetic message from the current user
+// @name is turned into a proper mention if the user exists
+func createMessage(line string) *discordgo.MessageCreate {
+	mentions := make([]*discordgo.User, 0)
+
+	fields := strings.Fields(line)
+	for k, v := range fields {
+		if !strings.HasPrefix(v, "@") || len(v) < 2 {
+			continue
+		}
+
+		user, err := transport.FindMember(LocalChannel, v[1:])
+		if err != nil {
+			continue
+		}
+
+		fields[k] = "<@" + user.ID + ">"
+		mentions = append(mentions, user)
+	}
+
+	lastMsgID++
+	return &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        "in" + strconv.Itoa(lastMsgID),
+			ChannelID: channel,
+			GuildID:   LocalGuild,
+			Content:   strings.Join(fields, " "),
+			Author:    current,
+			Mentions:  mentions,
+		},
+	}
+}
+
+func printMessage(msg *discordgo.Message, edit bool) {
+	prefix := "[" + msg.Author.Username + "]"
+	if edit {
+		prefix += " (edited)"
+	}
+	if strings.HasPrefix(msg.ChannelID, "dm:") {
+		prefix += " (dm " + msg.ChannelID[3:] + ")"
+	} else if msg.ChannelID != channel {
+		prefix += " (#" + msg.ChannelID + ")"
+	}
+
+	fmt.Println("\n" + prefix + " " + msg.Content)
+
+	for _, row := range msg.Components {
+		actionsRow, ok := row.(discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+
+		for _, component := range actionsRow.Components {
+			if button, ok := component.(discordgo.Button); ok {
+				fmt.Printf("  [%s] /press %s\n", button.Label, button.CustomID)
+			}
+		}
+	}
+}
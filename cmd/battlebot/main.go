@@ -7,6 +7,7 @@ import (
 )
 
 func main() {
+	core.ParseFlags()
 	items.RegisterGenericItems()
 	core.Run()
 }
@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"github.com/jonas747/battlebot/core"
+	"strings"
+)
+
+var AdminCommands = []*core.CommandDef{
+	&core.CommandDef{
+		Name:        "admin",
+		Category:    "Admin",
+		Description: "Bot administration",
+		Permission:  core.PermissionModerator,
+		Subcommands: []*core.CommandDef{
+			&core.CommandDef{
+				Name:         "give",
+				Examples:     []string{"admin give 4 @bob", "create 4"},
+				Description:  "Creates an item for someone, or yourself if no user is specified",
+				RootAliases:  []string{"create"},
+				RequiredArgs: 1,
+				Permission:   core.PermissionOwner,
+				Arguments: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "item", Type: core.ArgumentTypeItem},
+					&core.ArgumentDef{Name: "user", Type: core.ArgumentTypeUser},
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					player := ctx.Player()
+					if arg := ctx.Arg(1); arg != nil {
+						player = arg.GetCreatePlayer(ctx.Economy())
+					}
+
+					itemType := ctx.Args[0].ItemType()
+
+					tx := core.Ledger.Begin(core.ReasonCreate, ctx.Author.ID)
+					player.Lock()
+					tx.AddItem(player, itemType.Id)
+					name := player.Name
+					player.Unlock()
+					tx.Commit()
+
+					return ctx.Reply(ctx.T("admin.gave", name, itemType.LocalName(ctx.Language), itemType.Id))
+				},
+			},
+			&core.CommandDef{
+				Name:         "audit",
+				Examples:     []string{"admin audit @bob", "admin audit @bob 2"},
+				Description:  "Shows every money and item movement of someone",
+				RequiredArgs: 1,
+				Arguments: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "user", Type: core.ArgumentTypeUser},
+					core.PageArgument,
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					player := ctx.Args[0].GetCreatePlayer(ctx.Economy())
+					txs, err := core.Ledger.PlayerHistory(player)
+					if err != nil {
+						return err
+					}
+
+					card, rows := core.LedgerPages(player, txs, ctx.Language)
+					return ctx.ReplyPages(card, rows, core.DefaultPageSize)
+				},
+			},
+			&core.CommandDef{
+				Name:         "reverse",
+				Examples:     []string{"admin reverse 12"},
+				Description:  "Undoes a transaction from the ledger, if everyone involved still has what they got from it",
+				Permission:   core.PermissionOwner,
+				RequiredArgs: 1,
+				Arguments: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "transaction", Description: "Id of the transaction, see `admin audit`", Type: core.ArgumentTypeNumber},
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					tx, err := core.Ledger.Reverse(int64(ctx.Args[0].Int()), ctx.Author.ID)
+					if err != nil {
+						return err
+					}
+					return ctx.Reply(ctx.T("admin.reversed", tx.Reverses, tx.Id))
+				},
+			},
+			&core.CommandDef{
+				Name:         "copyplayers",
+				Examples:     []string{"admin copyplayers 123456789012345678"},
+				Description:  "Copies everyone's global money, items and stats into a server's own economy, skipping people who already played there",
+				Permission:   core.PermissionOwner,
+				RequiredArgs: 1,
+				Arguments: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "server", Description: "Id of the server", Type: core.ArgumentTypeString},
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					guild := ctx.Args[0].Str()
+					// Player keys use / to separate the server and user
+					if strings.Contains(guild, "/") {
+						return core.NewLocaleError("admin.copyplayers.bad_id", guild)
+					}
+
+					n, err := core.Players.CopyToGuild(guild, ctx.Author.ID)
+					if err != nil {
+						return err
+					}
+
+					if core.Guilds.Economy(guild) == "" {
+						return ctx.Reply(ctx.TN("admin.copyplayers.done_global", n, n, guild))
+					}
+					return ctx.Reply(ctx.TN("admin.copyplayers.done", n, n, guild))
+				},
+			},
+			&core.CommandDef{
+				Name:         "maintenance",
+				Examples:     []string{"admin maintenance on Restarting for an update", "admin maintenance off"},
+				Description:  "Turns maintenance mode on or off, only bot owners can use commands while it's on",
+				Permission:   core.PermissionOwner,
+				RequiredArgs: 1,
+				Arguments: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "state", Type: core.ArgumentTypeEnum, Choices: toggleChoices},
+					&core.ArgumentDef{Name: "reason", Description: "Shown to people trying to use commands", Type: core.ArgumentTypeString, Greedy: true},
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					enabled := ctx.Args[0].Parsed.(bool)
+
+					reason := ""
+					if arg := ctx.Arg(1); arg != nil {
+						reason = arg.Str()
+					}
+
+					core.Maintenance.Set(enabled, reason)
+					if enabled {
+						return ctx.Reply(ctx.T("admin.maintenance_on"))
+					}
+					return ctx.Reply(ctx.T("admin.maintenance_off"))
+				},
+			},
+		},
+	},
+}
+
+var toggleChoices = []*core.ArgumentChoice{
+	&core.ArgumentChoice{Name: "on", Aliases: []string{"enable", "true"}, Value: true},
+	&core.ArgumentChoice{Name: "off", Aliases: []string{"disable", "false"}, Value: false},
+}
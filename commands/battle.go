@@ -1,14 +1,17 @@
 package commands
 
 import (
-	"fmt"
-	"github.com/bwmarrin/discordgo"
 	"github.com/jonas747/battlebot/core"
+	"time"
 )
 
+var errNoPendingBattles = core.NewLocaleError("battle.no_pending")
+
 var BattleCommands = []*core.CommandDef{
 	&core.CommandDef{
 		Name:         "battle",
+		Category:     "Battle",
+		Examples:     []string{"battle @bob", "battle @bob 10", `battle "john smith" 5`},
 		Description:  "Requests a battle with another player",
 		Aliases:      []string{"b"},
 		RequiredArgs: 1,
@@ -16,69 +19,117 @@ var BattleCommands = []*core.CommandDef{
 			&core.ArgumentDef{Name: "user", Description: "User to battle against", Type: core.ArgumentTypeUser},
 			&core.ArgumentDef{Name: "money", Description: "Money to battle over, both of you put in this amountand winner gets all", Type: core.ArgumentTypeNumber},
 		},
-		RunFunc: func(p *core.ParsedCommand, m *discordgo.MessageCreate) {
-			user := p.Args[0].DiscordUser()
-			if m.Author.ID == user.ID {
-				go core.SendMessage(m.ChannelID, "Can't fight yourself you idiot")
-				return
+		RunFunc: func(ctx *core.CommandContext) error {
+			user := ctx.Args[0].DiscordUser()
+			if ctx.Author.ID == user.ID {
+				return core.NewLocaleError("battle.self")
 			}
 
 			money := 1
-			if len(p.Args) > 1 && p.Args[1] != nil {
-				money = p.Args[1].Int()
+			if arg := ctx.Arg(1); arg != nil {
+				money = arg.Int()
 			}
 
-			attacker := core.Players.GetCreatePlayer(m.Author.ID, m.Author.Username)
-			defender := core.Players.GetCreatePlayer(user.ID, user.Username)
+			attacker := ctx.Player()
+			defender := core.Players.GetCreatePlayer(ctx.Economy(), user.ID, user.Username)
 
-			noMoneyMsg := ""
 			attacker.RLock()
-			if attacker.Money < money {
-				noMoneyMsg = "You"
-			}
+			attackerMoney := attacker.Money
 			attacker.RUnlock()
-			defender.RLock()
-			if noMoneyMsg == "" && defender.Money < money {
-				noMoneyMsg = defender.Name
+			if attackerMoney < money {
+				return core.NewLocaleError("battle.no_money_self")
 			}
+
+			defender.RLock()
+			defenderMoney := defender.Money
+			defenderName := defender.Name
 			defender.RUnlock()
+			if defenderMoney < money {
+				return core.NewLocaleError("battle.no_money_other", defenderName)
+			}
 
-			if noMoneyMsg != "" {
-				go core.SendMessage(m.ChannelID, noMoneyMsg+" do not have enough money to battle :'( Battle some monsters first?")
-				return
+			battle := core.NewBattle(attacker, defender, money, ctx.ChannelID)
+			battle.Language = ctx.Language
+			if !core.Battles.MaybeAddBattle(battle) {
+				return core.NewLocaleError("battle.already_battling")
 			}
 
-			battle := core.NewBattle(attacker, defender, money, m.ChannelID)
-			if core.Battles.MaybeAddBattle(battle) {
-				go core.SendMessage(m.ChannelID, fmt.Sprintf("<@%s> Has requested a battle with <@%s> for %d$, you got 60 seconds.\nRepond with `@BattleBot accept`", m.Author.ID, user.ID, money))
-			} else {
-				go core.SendMessage(m.ChannelID, "Did not request battle")
+			msg, err := ctx.ReplyComplex(battle.ChallengeMessage())
+			if err != nil {
+				return err
 			}
+
+			battle.Lock()
+			battle.MessageID = msg.ID
+			battle.Unlock()
+			return nil
 		},
 	},
 	&core.CommandDef{
 		Name:        "battlemonster",
+		Category:    "Battle",
 		Aliases:     []string{"bm"},
 		Description: "Battle a random monster at your level",
-		RunFunc: func(p *core.ParsedCommand, m *discordgo.MessageCreate) {
-			player := core.Players.GetCreatePlayer(m.Author.ID, m.Author.Username)
+		Cooldown:    time.Second * 10,
+		RunFunc: func(ctx *core.CommandContext) error {
+			player := ctx.Player()
 
-			monster := core.GetMonster(core.GetLevelFromXP(player.XP))
+			monster := core.GetMonster(core.GetLevelFromXP(player.XP), ctx.Language)
 
-			battle := core.NewBattle(player, monster.Player, monster.Money, m.ChannelID)
+			battle := core.NewBattle(player, monster.Player, monster.Money, ctx.ChannelID)
 			battle.IsMonster = true
+			battle.Language = ctx.Language
 
 			battle.Battle()
+			return nil
 		},
 	},
 	&core.CommandDef{
 		Name:        "accept",
+		Category:    "Battle",
 		Description: "Accepts the pending battle",
 		Aliases:     []string{"a"},
-		RunFunc: func(p *core.ParsedCommand, m *discordgo.MessageCreate) {
-			if !core.Battles.MaybeAcceptBattle(m.Author.ID) {
-				go core.SendMessage(m.ChannelID, "You have no pending battles")
+		RunFunc: func(ctx *core.CommandContext) error {
+			if !core.Battles.MaybeAcceptBattle(ctx.Author.ID) {
+				return errNoPendingBattles
+			}
+			return nil
+		},
+	},
+	&core.CommandDef{
+		Name:        "decline",
+		Category:    "Battle",
+		Description: "Declines the pending battle, or cancels the one you requested",
+		Aliases:     []string{"d", "cancel"},
+		RunFunc: func(ctx *core.CommandContext) error {
+			if !core.Battles.MaybeDeclineBattle(ctx.Author.ID) {
+				return errNoPendingBattles
+			}
+			return nil
+		},
+	},
+	&core.CommandDef{
+		Name:        "battles",
+		Category:    "Battle",
+		Examples:    []string{"battles", "battles 2", "battles --user @bob"},
+		Description: "Shows your most recent battles",
+		Arguments: []*core.ArgumentDef{
+			core.PageArgument,
+		},
+		Flags: []*core.ArgumentDef{
+			&core.ArgumentDef{Name: "user", Description: "User to show battles for, leave empty for yourself", Type: core.ArgumentTypeUser},
+		},
+		RunFunc: func(ctx *core.CommandContext) error {
+			player := ctx.Player()
+			if flag := ctx.Flag("user"); flag != nil {
+				player = flag.GetCreatePlayer(ctx.Economy())
 			}
+
+			player.RLock()
+			card, rows := player.HistoryPages(ctx.Language)
+			player.RUnlock()
+
+			return ctx.ReplyPages(card, rows, core.DefaultPageSize)
 		},
 	},
 }
@@ -8,5 +8,8 @@ func init() {
 	core.RegisterCommands(MiscCommands...)
 	core.RegisterCommands(BattleCommands...)
 	core.RegisterCommands(InventoryCommands...)
+	core.RegisterCommands(ShopCommands...)
 	core.RegisterCommands(PlayerCommands...)
+	core.RegisterCommands(GuildCommands...)
+	core.RegisterCommands(AdminCommands...)
 }
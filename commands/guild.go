@@ -0,0 +1,577 @@
+package commands
+
+import (
+	"github.com/jonas747/battlebot/core"
+	"log"
+	"sort"
+	"strings"
+)
+
+var errGuildOnly = core.NewLocaleError("server.guild_only")
+
+var GuildCommands = []*core.CommandDef{
+	&core.CommandDef{
+		Name:          "server",
+		Category:      "Server",
+		Description:   "Shows and changes the settings for this server",
+		AlwaysEnabled: true,
+		Subcommands: []*core.CommandDef{
+			&core.CommandDef{
+				Name:        "prefix",
+				Examples:    []string{"server prefix", "prefix"},
+				Description: "Shows the command prefix for this server",
+				RootAliases: []string{"prefix"},
+				RunFunc: func(ctx *core.CommandContext) error {
+					if ctx.GuildID == "" {
+						return errGuildOnly
+					}
+
+					prefix := core.Guilds.Prefix(ctx.GuildID)
+					if prefix == "" {
+						return ctx.Reply(ctx.T("server.prefix.none"))
+					}
+					return ctx.Reply(ctx.T("server.prefix.current", prefix))
+				},
+				Subcommands: []*core.CommandDef{
+					&core.CommandDef{
+						Name:         "set",
+						Examples:     []string{"server prefix set !bb", "setprefix none"},
+						Description:  "Changes the command prefix for this server",
+						RootAliases:  []string{"setprefix"},
+						Permission:   core.PermissionAdmin,
+						RequiredArgs: 1,
+						Arguments: []*core.ArgumentDef{
+							&core.ArgumentDef{Name: "prefix", Description: "The new prefix, e.g `!bb`, or `none` to only respond to mentions", Type: core.ArgumentTypeString},
+						},
+						RunFunc: func(ctx *core.CommandContext) error {
+							if ctx.GuildID == "" {
+								return errGuildOnly
+							}
+
+							prefix := ctx.Args[0].Str()
+							if strings.EqualFold(prefix, "none") {
+								prefix = ""
+							}
+
+							if len(prefix) > core.MaxPrefixLength {
+								return core.NewLocaleError("server.prefix.too_long")
+							}
+
+							settings := core.Guilds.GetCreate(ctx.GuildID)
+							settings.Lock()
+							settings.Prefix = prefix
+							settings.Unlock()
+
+							err := core.Guilds.Save()
+							if err != nil {
+								log.Println("Failed saving guild settings:", err)
+							}
+
+							if prefix == "" {
+								return ctx.Reply(ctx.T("server.prefix.removed"))
+							}
+							return ctx.Reply(ctx.T("server.prefix.changed", prefix))
+						},
+					},
+				},
+			},
+			&core.CommandDef{
+				Name:        "language",
+				Examples:    []string{"server language"},
+				Description: "Shows the language for this server and the available ones",
+				Aliases:     []string{"lang"},
+				RunFunc: func(ctx *core.CommandContext) error {
+					if ctx.GuildID == "" {
+						return errGuildOnly
+					}
+
+					code := core.Guilds.Language(ctx.GuildID)
+					if code == "" {
+						code = core.DefaultLanguage()
+					}
+					return ctx.Reply(ctx.T("server.language.current", core.LanguageName(code), languageList()))
+				},
+				Subcommands: []*core.CommandDef{
+					&core.CommandDef{
+						Name:         "set",
+						Examples:     []string{"server language set fr", "server language set default"},
+						Description:  "Changes the language for this server, members can still pick their own with the language command",
+						Permission:   core.PermissionAdmin,
+						RequiredArgs: 1,
+						Arguments: []*core.ArgumentDef{
+							&core.ArgumentDef{Name: "language", Description: "Language code, or `default` to use the bots default language", Type: core.ArgumentTypeString},
+						},
+						RunFunc: func(ctx *core.CommandContext) error {
+							if ctx.GuildID == "" {
+								return errGuildOnly
+							}
+
+							code, err := parseLanguage(ctx.Args[0].Str())
+							if err != nil {
+								return err
+							}
+
+							settings := core.Guilds.GetCreate(ctx.GuildID)
+							settings.Lock()
+							settings.Language = code
+							settings.Unlock()
+
+							err = core.Guilds.Save()
+							if err != nil {
+								log.Println("Failed saving guild settings:", err)
+							}
+
+							if code == "" {
+								code = core.DefaultLanguage()
+							}
+							return ctx.Reply(core.T(code, "server.language.changed", core.LanguageName(code)))
+						},
+					},
+				},
+			},
+			&core.CommandDef{
+				Name:        "economy",
+				Examples:    []string{"server economy"},
+				Description: "Shows whether this server has its own money, items and leaderboards or uses the global ones",
+				RunFunc: func(ctx *core.CommandContext) error {
+					if ctx.GuildID == "" {
+						return errGuildOnly
+					}
+
+					if ctx.Economy() != "" {
+						return ctx.Reply(ctx.T("server.economy.current_local"))
+					}
+					return ctx.Reply(ctx.T("server.economy.current_global"))
+				},
+				Subcommands: []*core.CommandDef{
+					&core.CommandDef{
+						Name:         "set",
+						Examples:     []string{"server economy set local", "server economy set global"},
+						Description:  "Changes whether this server has its own money, items and leaderboards or uses the global ones",
+						Permission:   core.PermissionAdmin,
+						RequiredArgs: 1,
+						Arguments: []*core.ArgumentDef{
+							&core.ArgumentDef{Name: "economy", Type: core.ArgumentTypeEnum, Choices: economyChoices},
+						},
+						RunFunc: func(ctx *core.CommandContext) error {
+							if ctx.GuildID == "" {
+								return errGuildOnly
+							}
+
+							local := ctx.Args[0].Parsed.(bool)
+
+							settings := core.Guilds.GetCreate(ctx.GuildID)
+							settings.Lock()
+							settings.LocalEconomy = local
+							settings.Unlock()
+
+							err := core.Guilds.Save()
+							if err != nil {
+								log.Println("Failed saving guild settings:", err)
+							}
+
+							if local {
+								return ctx.Reply(ctx.T("server.economy.changed_local"))
+							}
+							return ctx.Reply(ctx.T("server.economy.changed_global"))
+						},
+					},
+				},
+			},
+			&core.CommandDef{
+				Name:        "roles",
+				Description: "Shows the roles that give bot admin or moderator permissions in this server",
+				RootAliases: []string{"roles"},
+				Permission:  core.PermissionModerator,
+				RunFunc: func(ctx *core.CommandContext) error {
+					if ctx.GuildID == "" {
+						return errGuildOnly
+					}
+
+					settings := core.Guilds.GetCreate(ctx.GuildID)
+					settings.RLock()
+					out := ctx.T("server.roles.list", roleMentions(ctx, settings.AdminRoles), roleMentions(ctx, settings.ModeratorRoles))
+					settings.RUnlock()
+
+					return ctx.Reply(out)
+				},
+				Subcommands: []*core.CommandDef{
+					&core.CommandDef{
+						Name:         "add",
+						Examples:     []string{"server roles add mod @Helpers", "addrole admin 123456789012345678"},
+						Description:  "Gives members with a role bot admin or moderator permissions in this server",
+						RootAliases:  []string{"addrole"},
+						Permission:   core.PermissionAdmin,
+						RequiredArgs: 2,
+						Arguments: []*core.ArgumentDef{
+							&core.ArgumentDef{Name: "level", Description: "Permission level to give", Type: core.ArgumentTypeEnum, Choices: core.RolePermissionChoices},
+							&core.ArgumentDef{Name: "role", Description: "Role mention or id", Type: core.ArgumentTypeRole},
+						},
+						RunFunc: func(ctx *core.CommandContext) error {
+							if ctx.GuildID == "" {
+								return errGuildOnly
+							}
+
+							level := ctx.Args[0].Parsed.(core.PermissionLevel)
+							role := ctx.Args[1].Str()
+
+							if !core.Guilds.GetCreate(ctx.GuildID).AddRole(level, role) {
+								return core.NewLocaleError("server.roles.already_has", role, level.LocalName(ctx.Language))
+							}
+
+							err := core.Guilds.Save()
+							if err != nil {
+								log.Println("Failed saving guild settings:", err)
+							}
+
+							return ctx.Reply(ctx.T("server.roles.added", role, level.LocalName(ctx.Language)))
+						},
+					},
+					&core.CommandDef{
+						Name:         "remove",
+						Examples:     []string{"server roles remove mod @Helpers", "removerole mod @Helpers"},
+						Description:  "Removes bot admin or moderator permissions from a role in this server",
+						RootAliases:  []string{"removerole"},
+						Permission:   core.PermissionAdmin,
+						RequiredArgs: 2,
+						Arguments: []*core.ArgumentDef{
+							&core.ArgumentDef{Name: "level", Description: "Permission level to remove", Type: core.ArgumentTypeEnum, Choices: core.RolePermissionChoices},
+							&core.ArgumentDef{Name: "role", Description: "Role mention or id", Type: core.ArgumentTypeRole},
+						},
+						RunFunc: func(ctx *core.CommandContext) error {
+							if ctx.GuildID == "" {
+								return errGuildOnly
+							}
+
+							level := ctx.Args[0].Parsed.(core.PermissionLevel)
+							role := ctx.Args[1].Str()
+
+							if !core.Guilds.GetCreate(ctx.GuildID).RemoveRole(level, role) {
+								return core.NewLocaleError("server.roles.doesnt_have", role, level.LocalName(ctx.Language))
+							}
+
+							err := core.Guilds.Save()
+							if err != nil {
+								log.Println("Failed saving guild settings:", err)
+							}
+
+							return ctx.Reply(ctx.T("server.roles.removed", role, level.LocalName(ctx.Language)))
+						},
+					},
+				},
+			},
+			&core.CommandDef{
+				Name:        "disable",
+				Examples:    []string{"server disable", "server disable battle", "server disable shop buy", "server disable --category Battle", "server disable givemoney --channel #general"},
+				Description: "Disables a command or category in this server or a channel, or lists the disabled ones",
+				Permission:  core.PermissionAdmin,
+				Arguments: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "command", Description: "The command to disable, disabling a command also disables its subcommands", Type: core.ArgumentTypeString, Greedy: true},
+				},
+				Flags: []*core.ArgumentDef{
+					categoryFlag,
+					&core.ArgumentDef{Name: "channel", Description: "Only disable it in this channel", Type: core.ArgumentTypeChannel},
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					if ctx.GuildID == "" {
+						return errGuildOnly
+					}
+
+					settings := core.Guilds.GetCreate(ctx.GuildID)
+					channel := flagStr(ctx, "channel")
+
+					if ctx.Arg(0) == nil && ctx.Flag("category") == nil {
+						return ctx.Reply(disabledList(ctx, settings, channel))
+					}
+
+					name, isCategory, err := filterTarget(ctx)
+					if err != nil {
+						return err
+					}
+
+					if isCategory {
+						if !settings.DisableCategory(channel, name) {
+							return core.NewLocaleError("server.disable.already", name)
+						}
+					} else {
+						cmd, err := findCommandPath(name)
+						if err != nil {
+							return err
+						}
+
+						if !cmd.CanDisable() {
+							return core.NewLocaleError("server.disable.cant", cmd.FullName())
+						}
+
+						name = cmd.FullName()
+						if !settings.DisableCommand(channel, name) {
+							return core.NewLocaleError("server.disable.already", name)
+						}
+					}
+
+					err = core.Guilds.Save()
+					if err != nil {
+						log.Println("Failed saving guild settings:", err)
+					}
+
+					if channel != "" {
+						return ctx.Reply(ctx.T("server.disable.done_channel", name, channel))
+					}
+					return ctx.Reply(ctx.T("server.disable.done", name))
+				},
+			},
+			&core.CommandDef{
+				Name:        "enable",
+				Examples:    []string{"server enable battle", "server enable --category Battle", "server enable givemoney --channel #general"},
+				Description: "Enables a disabled command or category in this server or a channel",
+				Permission:  core.PermissionAdmin,
+				Arguments: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "command", Description: "The command to enable", Type: core.ArgumentTypeString, Greedy: true},
+				},
+				Flags: []*core.ArgumentDef{
+					categoryFlag,
+					&core.ArgumentDef{Name: "channel", Description: "Enable it in this channel, if it was disabled only there", Type: core.ArgumentTypeChannel},
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					if ctx.GuildID == "" {
+						return errGuildOnly
+					}
+
+					name, isCategory, err := filterTarget(ctx)
+					if err != nil {
+						return err
+					}
+
+					settings := core.Guilds.GetCreate(ctx.GuildID)
+					channel := flagStr(ctx, "channel")
+
+					if isCategory {
+						if !settings.EnableCategory(channel, name) {
+							return core.NewLocaleError("server.enable.not_disabled", name)
+						}
+					} else {
+						cmd, err := findCommandPath(name)
+						if err != nil {
+							return err
+						}
+
+						name = cmd.FullName()
+						if !settings.EnableCommand(channel, name) {
+							return core.NewLocaleError("server.enable.not_disabled", name)
+						}
+					}
+
+					err = core.Guilds.Save()
+					if err != nil {
+						log.Println("Failed saving guild settings:", err)
+					}
+
+					if channel != "" {
+						return ctx.Reply(ctx.T("server.enable.done_channel", name, channel))
+					}
+					return ctx.Reply(ctx.T("server.enable.done", name))
+				},
+			},
+			&core.CommandDef{
+				Name:        "channels",
+				Examples:    []string{"server channels"},
+				Description: "Shows the channels commands are restricted to in this server",
+				Permission:  core.PermissionModerator,
+				RunFunc: func(ctx *core.CommandContext) error {
+					if ctx.GuildID == "" {
+						return errGuildOnly
+					}
+
+					channels := core.Guilds.AllowedChannels(ctx.GuildID)
+					if len(channels) < 1 {
+						return ctx.Reply(ctx.T("server.channels.all"))
+					}
+					return ctx.Reply(ctx.T("server.channels.list", channelMentions(ctx, channels)))
+				},
+				Subcommands: []*core.CommandDef{
+					&core.CommandDef{
+						Name:         "add",
+						Examples:     []string{"server channels add #battles"},
+						Description:  "Restricts commands to a channel, commands can be used in every channel added this way",
+						Permission:   core.PermissionAdmin,
+						RequiredArgs: 1,
+						Arguments: []*core.ArgumentDef{
+							&core.ArgumentDef{Name: "channel", Description: "Channel mention or id", Type: core.ArgumentTypeChannel},
+						},
+						RunFunc: func(ctx *core.CommandContext) error {
+							if ctx.GuildID == "" {
+								return errGuildOnly
+							}
+
+							channel := ctx.Args[0].Str()
+							if !core.Guilds.GetCreate(ctx.GuildID).AllowChannel(channel) {
+								return core.NewLocaleError("server.channels.already", channel)
+							}
+
+							err := core.Guilds.Save()
+							if err != nil {
+								log.Println("Failed saving guild settings:", err)
+							}
+
+							return ctx.Reply(ctx.T("server.channels.added", channel))
+						},
+					},
+					&core.CommandDef{
+						Name:         "remove",
+						Examples:     []string{"server channels remove #battles"},
+						Description:  "Removes a channel from the ones commands are restricted to, once none are left commands work everywhere",
+						Permission:   core.PermissionAdmin,
+						RequiredArgs: 1,
+						Arguments: []*core.ArgumentDef{
+							&core.ArgumentDef{Name: "channel", Description: "Channel mention or id", Type: core.ArgumentTypeChannel},
+						},
+						RunFunc: func(ctx *core.CommandContext) error {
+							if ctx.GuildID == "" {
+								return errGuildOnly
+							}
+
+							channel := ctx.Args[0].Str()
+							if !core.Guilds.GetCreate(ctx.GuildID).DisallowChannel(channel) {
+								return core.NewLocaleError("server.channels.not_added", channel)
+							}
+
+							err := core.Guilds.Save()
+							if err != nil {
+								log.Println("Failed saving guild settings:", err)
+							}
+
+							if len(core.Guilds.AllowedChannels(ctx.GuildID)) < 1 {
+								return ctx.Reply(ctx.T("server.channels.removed_last", channel))
+							}
+							return ctx.Reply(ctx.T("server.channels.removed", channel))
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+func roleMentions(ctx *core.CommandContext, roles []string) string {
+	if len(roles) < 1 {
+		return ctx.T("list.none")
+	}
+
+	out := make([]string, len(roles))
+	for k, v := range roles {
+		out[k] = "<@&" + v + ">"
+	}
+	return strings.Join(out, ", ")
+}
+
+func channelMentions(ctx *core.CommandContext, channels []string) string {
+	if len(channels) < 1 {
+		return ctx.T("list.none")
+	}
+
+	out := make([]string, len(channels))
+	for k, v := range channels {
+		out[k] = "<#" + v + ">"
+	}
+	return strings.Join(out, ", ")
+}
+
+func commandList(ctx *core.CommandContext, names []string) string {
+	if len(names) < 1 {
+		return ctx.T("list.none")
+	}
+	return "`" + strings.Join(names, "`, `") + "`"
+}
+
+// Returns the loaded languages as a list of codes and names
+func languageList() string {
+	codes := core.Languages.Codes()
+	out := make([]string, len(codes))
+	for k, code := range codes {
+		out[k] = "`" + code + "` " + core.LanguageName(code)
+	}
+	return strings.Join(out, ", ")
+}
+
+// Parses a language code, `default` returns an empty code
+func parseLanguage(code string) (string, error) {
+	if strings.EqualFold(code, "default") {
+		return "", nil
+	}
+	return core.Languages.Find(code)
+}
+
+// Finds a command by its names, e.g `shop buy`
+func findCommandPath(path string) (*core.CommandDef, error) {
+	tokens, err := core.Tokenize(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, rest := core.ResolveCommand(tokens)
+	if cmd == nil || len(rest) > 0 {
+		return nil, core.NewLocaleError("server.unknown_command", path)
+	}
+	return cmd, nil
+}
+
+var categoryFlag = &core.ArgumentDef{Name: "category", Description: "A command category to use instead of a command, e.g `Battle`", Type: core.ArgumentTypeString}
+
+// Returns the value of a string flag, empty if not set
+func flagStr(ctx *core.CommandContext, name string) string {
+	if flag := ctx.Flag(name); flag != nil {
+		return flag.Str()
+	}
+	return ""
+}
+
+// Returns the category from the category flag, or the command argument for server disable and enable
+func filterTarget(ctx *core.CommandContext) (name string, isCategory bool, err error) {
+	flag := ctx.Flag("category")
+	if flag == nil {
+		if ctx.Arg(0) == nil {
+			return "", false, core.NewLocaleError("server.disable.nothing")
+		}
+		return ctx.Args[0].Str(), false, nil
+	}
+
+	if ctx.Arg(0) != nil {
+		return "", false, core.NewLocaleError("server.disable.both")
+	}
+
+	category, err := core.FindCategory(flag.Str())
+	return category, true, err
+}
+
+// Returns the disabled commands and categories for the guild, or channel if not empty
+func disabledList(ctx *core.CommandContext, settings *core.GuildSettings, channel string) string {
+	settings.RLock()
+	defer settings.RUnlock()
+
+	if channel != "" {
+		filter := core.CommandFilter{}
+		if cs, ok := settings.Channels[channel]; ok {
+			filter = cs.CommandFilter
+		}
+		return ctx.T("server.disable.list_channel", channel, commandList(ctx, filter.DisabledCommands), commandList(ctx, filter.DisabledCategories))
+	}
+
+	out := ctx.T("server.disable.list", commandList(ctx, settings.DisabledCommands), commandList(ctx, settings.DisabledCategories))
+
+	channels := make([]string, 0, len(settings.Channels))
+	for id := range settings.Channels {
+		channels = append(channels, id)
+	}
+	sort.Strings(channels)
+
+	for _, id := range channels {
+		cs := settings.Channels[id]
+		out += "\n" + ctx.T("server.disable.list_channel", id, commandList(ctx, cs.DisabledCommands), commandList(ctx, cs.DisabledCategories))
+	}
+	return out
+}
+
+var economyChoices = []*core.ArgumentChoice{
+	&core.ArgumentChoice{Name: "global", Aliases: []string{"shared"}, Value: false},
+	&core.ArgumentChoice{Name: "local", Aliases: []string{"server"}, Value: true},
+}
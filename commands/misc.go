@@ -1,24 +1,37 @@
 package commands
 
 import (
-	"github.com/bwmarrin/discordgo"
 	"github.com/jonas747/battlebot/core"
 )
 
 var MiscCommands = []*core.CommandDef{
 	&core.CommandDef{
-		Name:        "help",
-		Description: "Prints help info",
-		RunFunc: func(p *core.ParsedCommand, m *discordgo.MessageCreate) {
-			core.SendHelp(m.ChannelID, "")
+		Name:          "help",
+		Category:      "Misc",
+		AlwaysEnabled: true,
+		Examples:      []string{"help", "help --page 2", "help battle", "help shop buy"},
+		Description:   "Prints help info, or detailed help about a command",
+		Arguments: []*core.ArgumentDef{
+			&core.ArgumentDef{Name: "command", Description: "Command or alias to show detailed help for", Type: core.ArgumentTypeString, Greedy: true},
+		},
+		Flags: []*core.ArgumentDef{
+			core.PageArgument,
+		},
+		RunFunc: func(ctx *core.CommandContext) error {
+			name := ""
+			if arg := ctx.Arg(0); arg != nil {
+				name = arg.Str()
+			}
+			return core.SendHelp(ctx, name)
 		},
 	},
 
 	&core.CommandDef{
 		Name:        "invite",
+		Category:    "Misc",
 		Description: "Responds with a bot invite link",
-		RunFunc: func(p *core.ParsedCommand, m *discordgo.MessageCreate) {
-			go core.SendMessage(m.ChannelID, "**Invite link:** https://discordapp.com/oauth2/authorize?client_id=197048228099784704&scope=bot&permissions=101376")
+		RunFunc: func(ctx *core.CommandContext) error {
+			return ctx.Reply(ctx.T("invite.link", "https://discordapp.com/oauth2/authorize?client_id=197048228099784704&scope=bot&permissions=101376"))
 		},
 	},
 }
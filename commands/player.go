@@ -1,87 +1,77 @@
 package commands
 
 import (
-	"fmt"
-	"github.com/bwmarrin/discordgo"
 	"github.com/jonas747/battlebot/core"
-	"strings"
+	"sort"
+	"time"
 )
 
 var PlayerCommands = []*core.CommandDef{
 	&core.CommandDef{
 		Name:        "stats",
+		Category:    "Player",
+		Examples:    []string{"stats", "stats @bob"},
 		Aliases:     []string{"s"},
 		Description: "Shows stats for a user",
 		Arguments: []*core.ArgumentDef{
-			&core.ArgumentDef{Name: "User", Description: "User to see stats for, leave empty for yourself", Type: core.ArgumentTypeUser},
+			&core.ArgumentDef{Name: "User", Description: "User to see stats for, leave empty for yourself", Type: core.ArgumentTypeUser, Greedy: true},
 		},
-		RunFunc: func(p *core.ParsedCommand, m *discordgo.MessageCreate) {
-			var player *core.Player
-			if len(p.Args) > 0 && p.Args[0] != nil {
-				player = p.Args[0].GetCreatePlayer()
-			} else {
-				player = core.Players.GetCreatePlayer(m.Author.ID, m.Author.Username)
+		RunFunc: func(ctx *core.CommandContext) error {
+			player := ctx.Player()
+			if arg := ctx.Arg(0); arg != nil {
+				player = arg.GetCreatePlayer(ctx.Economy())
 			}
 
 			player.RLock()
-
-			out := "**Stats**\n" + player.GetPrettyDiscordStats()
-
+			card := player.StatsCard(ctx.Language)
 			player.RUnlock()
-			go core.SendMessage(m.ChannelID, out)
+
+			return ctx.ReplyEmbed(card)
 		},
 	},
 	&core.CommandDef{
 		Name:         "up",
+		Category:     "Player",
+		Examples:     []string{"up str", "up stamina 3"},
 		Description:  "Increases an attribute",
 		RequiredArgs: 1,
 		Arguments: []*core.ArgumentDef{
-			&core.ArgumentDef{Name: "attribute", Description: "The attribute to upgrade (one of  strength/str, agility/agi, stamina/stam)", Type: core.ArgumentTypeString},
+			&core.ArgumentDef{Name: "attribute", Description: "The attribute to upgrade", Type: core.ArgumentTypeEnum, Choices: core.AttributeChoices},
 			&core.ArgumentDef{Name: "amount", Description: "The amount to upgrade it by (1 if not specified", Type: core.ArgumentTypeNumber},
 		},
-		RunFunc: func(p *core.ParsedCommand, m *discordgo.MessageCreate) {
+		RunFunc: func(ctx *core.CommandContext) error {
 			num := 1
-			if len(p.Args) > 1 && p.Args[1] != nil {
-				num = p.Args[1].Int()
+			if arg := ctx.Arg(1); arg != nil {
+				num = arg.Int()
 			}
 			if num < 1 {
-				go core.SendMessage(m.ChannelID, "You can't increase attributes by anything less than 1 dummy")
-				return
+				return core.NewLocaleError("up.less_than_one")
 			}
 
-			player := core.Players.GetCreatePlayer(m.Author.ID, m.Author.Username)
+			player := ctx.Player()
 			player.Lock()
-			defer player.Unlock()
 
 			availablePoints := core.GetLevelFromXP(player.XP) - player.UsedAttributePoints()
 
 			if availablePoints < num {
-				go core.SendMessage(m.ChannelID, "No available attribute points")
-				return
-			}
-
-			attributeString := p.Args[0].Str()
-
-			var attribute core.AttributeType
-
-			switch strings.ToLower(attributeString) {
-			case "strength", "str":
-				attribute = core.AttributeStrength
-			case "agility", "ag", "agi":
-				attribute = core.AttributeAgility
-			case "stamina", "sta", "stam":
-				attribute = core.AttributeStamina
+				player.Unlock()
+				return core.NewLocaleError("up.no_points")
 			}
 
+			attribute := ctx.Args[0].Parsed.(core.AttributeType)
 			player.Attributes.Modify(attribute, num)
 
-			msg := fmt.Sprintf("Increased %s by %d\n\nCurrent stats:\n%s", attribute.String(), num, player.GetPrettyDiscordStats())
+			card := player.StatsCard(ctx.Language)
+			card.Description = ctx.T("up.increased", attribute.LocalName(ctx.Language), num)
+			player.Unlock()
 
-			go core.SendMessage(m.ChannelID, msg)
+			return ctx.ReplyEmbed(card)
 		},
 	},
 	&core.CommandDef{
 		Name:         "givemoney",
+		Category:     "Player",
+		Examples:     []string{"givemoney 10 @bob"},
 		Aliases:      []string{"givem", "gm"},
 		Description:  "Give someone money",
 		RequiredArgs: 2,
@@ -89,27 +79,161 @@ var PlayerCommands = []*core.CommandDef{
 			&core.ArgumentDef{Name: "Money", Description: "Money you want to give", Type: core.ArgumentTypeNumber},
 			&core.ArgumentDef{Name: "Receiver", Description: "Person who's receiving the item", Type: core.ArgumentTypeUser},
 		},
-		RunFunc: func(p *core.ParsedCommand, m *discordgo.MessageCreate) {
-			amount := p.Args[0].Int()
+		RunFunc: func(ctx *core.CommandContext) error {
+			amount := ctx.Args[0].Int()
+			if amount < 1 {
+				return core.NewLocaleError("givemoney.less_than_one")
+			}
 
-			sender := core.Players.GetCreatePlayer(m.Author.ID, m.Author.Username)
-			receiverUser := p.Args[1].DiscordUser()
-			receiver := core.Players.GetCreatePlayer(receiverUser.ID, receiverUser.Username)
+			sender := ctx.Player()
+			receiverUser := ctx.Args[1].DiscordUser()
+			receiver := core.Players.GetCreatePlayer(ctx.Economy(), receiverUser.ID, receiverUser.Username)
 
 			sender.Lock()
 			if sender.Money < amount {
-				go core.SendMessage(m.ChannelID, "Not enough money to send")
 				sender.Unlock()
-				return
+				return core.NewLocaleError("givemoney.no_money")
 			}
 
-			sender.Money -= amount
+			tx := core.Ledger.Begin(core.ReasonGiveMoney, ctx.Author.ID)
+			tx.AddMoney(sender, -amount)
 			sender.Unlock()
 
 			receiver.Lock()
-			receiver.Money += amount
-			go core.SendMessage(m.ChannelID, fmt.Sprintf("**%s** Gave **%s** %s$ (%d$ -> %d$)", sender.Name, receiver.Name, amount, receiver.Money-amount, receiver.Money))
+			tx.AddMoney(receiver, amount)
+			msg := ctx.T("givemoney.gave", sender.Name, receiver.Name, amount, receiver.Money-amount, receiver.Money)
 			receiver.Unlock()
+
+			tx.Commit()
+			return ctx.Reply(msg)
 		},
 	},
+	&core.CommandDef{
+		Name:        "history",
+		Category:    "Player",
+		Examples:    []string{"history", "history 2"},
+		Aliases:     []string{"transactions"},
+		Description: "Shows where your money and items came from and went",
+		Arguments: []*core.ArgumentDef{
+			core.PageArgument,
+		},
+		RunFunc: func(ctx *core.CommandContext) error {
+			player := ctx.Player()
+			txs, err := core.Ledger.PlayerHistory(player)
+			if err != nil {
+				return err
+			}
+
+			card, rows := core.LedgerPages(player, txs, ctx.Language)
+			return ctx.ReplyPages(card, rows, core.DefaultPageSize)
+		},
+	},
+	&core.CommandDef{
+		Name:        "language",
+		Category:    "Player",
+		Examples:    []string{"language", "language fr", "language default"},
+		Aliases:     []string{"lang"},
+		Description: "Shows the available languages or changes the language the bot uses with you",
+		Arguments: []*core.ArgumentDef{
+			&core.ArgumentDef{Name: "language", Description: "Language code, or `default` to use the servers language", Type: core.ArgumentTypeString},
+		},
+		RunFunc: func(ctx *core.CommandContext) error {
+			if ctx.Arg(0) == nil {
+				return ctx.Reply(ctx.T("language.current", core.LanguageName(ctx.Language), languageList()))
+			}
+
+			code, err := parseLanguage(ctx.Args[0].Str())
+			if err != nil {
+				return err
+			}
+
+			// Languages are kept on the global player, see core.LanguageFor
+			player := core.Players.GetCreatePlayer("", ctx.Author.ID, ctx.Author.Username)
+			player.Lock()
+			player.Language = code
+			player.Unlock()
+
+			if code == "" {
+				code = core.LanguageFor(ctx.Author.ID, ctx.GuildID)
+			}
+			return ctx.Reply(core.T(code, "language.changed", core.LanguageName(code)))
+		},
+	},
+	&core.CommandDef{
+		Name:        "cooldowns",
+		Category:    "Player",
+		Aliases:     []string{"cd"},
+		Description: "Shows your active command cooldowns",
+		RunFunc: func(ctx *core.CommandContext) error {
+			remaining := core.Cooldowns.Remaining(ctx.Author.ID)
+			if len(remaining) < 1 {
+				return ctx.Reply(ctx.T("cooldowns.none"))
+			}
+
+			names := make([]string, 0, len(remaining))
+			for name := range remaining {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			out := ctx.T("cooldowns.title") + "\n"
+			for _, name := range names {
+				seconds := int((remaining[name] + time.Second - 1) / time.Second)
+				out += ctx.TN("cooldowns.line", seconds, name, seconds) + "\n"
+			}
+			return ctx.Reply(out)
+		},
+	},
+	&core.CommandDef{
+		Name:        "top",
+		Category:    "Player",
+		Examples:    []string{"top", "top 2", "top --by money"},
+		Aliases:     []string{"leaderboard", "lb"},
+		Description: "Shows the players with the most xp, money or wins",
+		Arguments: []*core.ArgumentDef{
+			core.PageArgument,
+		},
+		Flags: []*core.ArgumentDef{
+			&core.ArgumentDef{Name: "by", Description: "What to rank players by, xp if not specified", Type: core.ArgumentTypeEnum, Choices: leaderboardChoices},
+		},
+		RunFunc: func(ctx *core.CommandContext) error {
+			by := "xp"
+			if flag := ctx.Flag("by"); flag != nil {
+				by = flag.Str()
+			}
+
+			card := &core.Card{
+				Title: ctx.T("top.title", ctx.T("top.by."+by)),
+				Color: core.ColorStats,
+			}
+
+			entries := core.Players.Leaderboard(ctx.Economy(), leaderboardValues[by])
+			rows := make([]string, 0, len(entries))
+			for k, v := range entries {
+				row := ctx.T("top.line", k+1, v.Name, v.Value)
+				if v.Id == ctx.Author.ID {
+					row = "__" + row + "__"
+				}
+				rows = append(rows, row)
+			}
+
+			if len(rows) < 1 {
+				card.Description = ctx.T("list.none")
+			}
+			return ctx.ReplyPages(card, rows, core.DefaultPageSize)
+		},
+	},
+}
+
+var leaderboardChoices = []*core.ArgumentChoice{
+	&core.ArgumentChoice{Name: "xp", Aliases: []string{"level"}, Value: "xp"},
+	&core.ArgumentChoice{Name: "money", Aliases: []string{"m"}, Value: "money"},
+	&core.ArgumentChoice{Name: "wins", Aliases: []string{"w"}, Value: "wins"},
+}
+
+// What the top command ranks players by, keyed by choice value
+var leaderboardValues = map[string]func(p *core.Player) int{
+	"xp":    func(p *core.Player) int { return p.XP },
+	"money": func(p *core.Player) int { return p.Money },
+	"wins":  func(p *core.Player) int { return p.Wins },
 }
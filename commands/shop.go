@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"github.com/jonas747/battlebot/core"
+)
+
+var ShopCommands = []*core.CommandDef{
+	&core.CommandDef{
+		Name:        "shop",
+		Category:    "Shop",
+		Description: "Browse and buy items",
+		Aliases:     []string{"store"},
+		Subcommands: []*core.CommandDef{
+			&core.CommandDef{
+				Name:        "list",
+				Examples:    []string{"shop list", "shop list 2", "items --slot head"},
+				Description: "Lists all items",
+				Aliases:     []string{"ls"},
+				RootAliases: []string{"items"},
+				Arguments: []*core.ArgumentDef{
+					core.PageArgument,
+				},
+				Flags: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "slot", Description: "Only list items that can be equipped in this slot", Type: core.ArgumentTypeEnum, Choices: core.EquipmentSlotChoices},
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					slot := core.EquipmentSlotNone
+					if flag := ctx.Flag("slot"); flag != nil {
+						slot = flag.Parsed.(core.EquipmentSlot)
+					}
+					card, rows := core.ItemListPages(slot, ctx.Language)
+					return ctx.ReplyPages(card, rows, core.DefaultPageSize)
+				},
+			},
+			&core.CommandDef{
+				Name:         "info",
+				Examples:     []string{"shop info 4", "item holy torso"},
+				Description:  "Shows info about an item or lists all items if item is not specified",
+				Aliases:      []string{"item", "i"},
+				RootAliases:  []string{"item", "i"},
+				RequiredArgs: 0,
+				Arguments: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "item", Description: "If item (id or name) is specifed shows detailed info about it, if not shows all items", Type: core.ArgumentTypeItem, Greedy: true},
+				},
+				Flags: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "slot", Description: "Only list items that can be equipped in this slot", Type: core.ArgumentTypeEnum, Choices: core.EquipmentSlotChoices},
+					core.PageArgument,
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					if arg := ctx.Arg(0); arg != nil {
+						return ctx.ReplyEmbed(arg.ItemType().Card(ctx.Language))
+					}
+
+					slot := core.EquipmentSlotNone
+					if flag := ctx.Flag("slot"); flag != nil {
+						slot = flag.Parsed.(core.EquipmentSlot)
+					}
+					card, rows := core.ItemListPages(slot, ctx.Language)
+					return ctx.ReplyPages(card, rows, core.DefaultPageSize)
+				},
+			},
+			&core.CommandDef{
+				Name:         "buy",
+				Examples:     []string{"shop buy 2", "buy knife"},
+				Description:  "Buys an item",
+				RootAliases:  []string{"buy"},
+				RequiredArgs: 1,
+				Arguments: []*core.ArgumentDef{
+					&core.ArgumentDef{Name: "item", Description: "Item you want to buy, by id or name (see `shop list` for item id's)", Type: core.ArgumentTypeItem, Greedy: true},
+				},
+				RunFunc: func(ctx *core.CommandContext) error {
+					itemType := ctx.Args[0].ItemType()
+
+					player := ctx.Player()
+					player.Lock()
+
+					if player.Money < itemType.Cost {
+						player.Unlock()
+						return core.NewLocaleError("shop.cant_afford")
+					}
+
+					tx := core.Ledger.Begin(core.ReasonBuy, ctx.Author.ID)
+					originalMoney := player.Money
+					tx.AddItem(player, itemType.Id)
+					tx.AddMoney(player, -itemType.Cost)
+					msg := ctx.T("shop.bought", player.Name, itemType.LocalName(ctx.Language), itemType.Id, itemType.Cost, originalMoney, player.Money)
+					player.Unlock()
+					tx.Commit()
+
+					return ctx.Reply(msg)
+				},
+			},
+		},
+	},
+}
@@ -20,6 +20,18 @@ func (a AttributeType) String() string {
 	return "Unknown"
 }
 
+// Returns the name of the attribute in language code
+func (a AttributeType) LocalName(code string) string {
+	return localName(code, "attribute", a.String())
+}
+
+// Attributes players can upgrade as argument choices
+var AttributeChoices = []*ArgumentChoice{
+	&ArgumentChoice{Name: "strength", Aliases: []string{"str"}, Value: AttributeStrength},
+	&ArgumentChoice{Name: "agility", Aliases: []string{"ag", "agi"}, Value: AttributeAgility},
+	&ArgumentChoice{Name: "stamina", Aliases: []string{"sta", "stam"}, Value: AttributeStamina},
+}
+
 type Attribute struct {
 	Type AttributeType
 	Val  int
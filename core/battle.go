@@ -2,7 +2,11 @@ package core
 
 import (
 	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"log"
 	"math/rand"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -15,16 +19,22 @@ type BattleManager struct {
 	sync.RWMutex
 
 	Battles []*Battle
+
+	closed bool // Set by Close, no battles can be started or accepted after that
 }
 
 func (bm *BattleManager) MaybeAddBattle(battle *Battle) bool {
 	bm.Lock()
 	defer bm.Unlock()
 
+	if bm.closed {
+		return false
+	}
+
 	for _, v := range bm.Battles {
 
 		v.RLock()
-		if v.ContainsPlayer(battle.Initiator.Player, false) || v.ContainsPlayer(battle.Defender.Player, false) {
+		if !v.Finished && (v.ContainsPlayer(battle.Initiator.Player, false) || v.ContainsPlayer(battle.Defender.Player, false)) {
 			v.RUnlock()
 			return false // Already battling
 		}
@@ -35,26 +45,44 @@ func (bm *BattleManager) MaybeAddBattle(battle *Battle) bool {
 	return true
 }
 
-func (bm *BattleManager) MaybeAcceptBattle(id string) bool {
+var (
+	ErrBattleNotFound = NewLocaleError("battle.not_found")
+	ErrNotYourBattle  = NewLocaleError("battle.not_yours")
+)
+
+// Stops new battles, waits for running battles to finish and cancels the pending challenges
+// Money is only moved when a battle ends, so cancelled challenges have nothing to refund
+func (bm *BattleManager) Close() {
 	bm.Lock()
 	defer bm.Unlock()
 
+	bm.closed = true
 	for _, battle := range bm.Battles {
-		battle.RLock()
-		if battle.Defender.Player.Id == id {
-			battle.RUnlock()
+		// Running battles hold their lock until they're finished
+		battle.Lock()
+		if !battle.Finished {
+			battle.Finished = true
+			battle.UpdateChallenge(battle.T("battle.shutdown", battle.Initiator.Player.Id, battle.Defender.Player.Id))
+		}
+		battle.Unlock()
+	}
+	bm.Battles = nil
+}
 
-			go func() {
-				battle.Lock()
-				if battle.Running || battle.Finished {
-					battle.Unlock()
-					return
-				}
+// Accepts the pending battle where id is the defender
+func (bm *BattleManager) MaybeAcceptBattle(id string) bool {
+	bm.Lock()
+	defer bm.Unlock()
 
-				battle.Battle()
-				battle.Unlock()
-			}()
+	if bm.closed {
+		return false
+	}
 
+	for _, battle := range bm.Battles {
+		battle.RLock()
+		if battle.Defender.Player.Id == id && !battle.Finished {
+			battle.RUnlock()
+			bm.acceptBattle(battle)
 			return true // BAttle possibly accepted
 		} else {
 			battle.RUnlock()
@@ -64,6 +92,106 @@ func (bm *BattleManager) MaybeAcceptBattle(id string) bool {
 	return false
 }
 
+// Accepts the battle with battleID, userID has to be the defender
+func (bm *BattleManager) AcceptBattleByID(battleID, userID string) error {
+	bm.Lock()
+	defer bm.Unlock()
+
+	if bm.closed {
+		return ErrShuttingDown
+	}
+
+	battle := bm.findBattle(battleID)
+	if battle == nil {
+		return ErrBattleNotFound
+	}
+
+	battle.RLock()
+	defender := battle.Defender.Player.Id
+	battle.RUnlock()
+	if defender != userID {
+		return ErrNotYourBattle
+	}
+
+	bm.acceptBattle(battle)
+	return nil
+}
+
+// Declines the pending battle where id is the defender, or cancels it if id is the initiator
+func (bm *BattleManager) MaybeDeclineBattle(id string) bool {
+	bm.Lock()
+	defer bm.Unlock()
+
+	for _, battle := range bm.Battles {
+		battle.Lock()
+		if !battle.Running && !battle.Finished && battle.ContainsPlayer(&Player{Id: id}, false) {
+			battle.Decline(id)
+			battle.Unlock()
+			return true
+		}
+		battle.Unlock()
+	}
+
+	return false
+}
+
+// Declines or cancels the battle with battleID, userID has to be in the battle
+func (bm *BattleManager) DeclineBattleByID(battleID, userID string) error {
+	bm.Lock()
+	defer bm.Unlock()
+
+	battle := bm.findBattle(battleID)
+	if battle == nil {
+		return ErrBattleNotFound
+	}
+
+	battle.Lock()
+	defer battle.Unlock()
+
+	if !battle.ContainsPlayer(&Player{Id: userID}, false) {
+		return ErrNotYourBattle
+	}
+	if battle.Running || battle.Finished {
+		return ErrBattleNotFound
+	}
+
+	battle.Decline(userID)
+	return nil
+}
+
+// Returns the pending battle with id, bm has to be locked
+func (bm *BattleManager) findBattle(id string) *Battle {
+	for _, battle := range bm.Battles {
+		battle.RLock()
+		if battle.Id == id && !battle.Finished {
+			battle.RUnlock()
+			return battle
+		}
+		battle.RUnlock()
+	}
+	return nil
+}
+
+// Starts the battle in the background, bm has to be locked
+// The battle could have expired or been declined before the lock is taken so it's checked again
+// Shutdown waits for it like for a command, so the payout is saved and recorded in the ledger
+func (bm *BattleManager) acceptBattle(battle *Battle) {
+	shutdown.running.Add(1)
+	go func() {
+		defer shutdown.running.Done()
+
+		battle.Lock()
+		if battle.Running || battle.Finished {
+			battle.Unlock()
+			return
+		}
+
+		battle.UpdateChallenge(battle.T("battle.accepted", battle.Defender.Player.Id, battle.Initiator.Player.Id, battle.Money))
+		battle.Battle()
+		battle.Unlock()
+	}()
+}
+
 func (bm *BattleManager) Run() {
 	ticker := time.NewTicker(time.Second)
 	for {
@@ -95,6 +223,7 @@ func (bm *BattleManager) CheckBattles() {
 type Battle struct {
 	sync.RWMutex
 
+	Id        string
 	Initiated time.Time // The time the battle was initiated
 
 	Finished bool // True if finished
@@ -103,6 +232,7 @@ type Battle struct {
 	Money int // The Money in the pot (well half)
 
 	Channel   string        // Channel stuff gets sent to in discord
+	MessageID string        // The challenge message, if any
 	Initiator *BattlePlayer // Attacker
 	Defender  *BattlePlayer // Defender
 
@@ -111,25 +241,103 @@ type Battle struct {
 	IsMonster bool // True if fighitng a monster
 	Log       []string
 	CurTurn   int
+
+	Language string // Language code for the messages and the battle log
 }
 
 func NewBattle(attacker *Player, defender *Player, money int, channel string) *Battle {
 	return &Battle{
+		Id:        strconv.FormatInt(time.Now().UnixNano(), 36),
 		Initiator: NewBattlePlayer(attacker),
 		Defender:  NewBattlePlayer(defender),
 		Initiated: time.Now(),
 		Channel:   channel,
 		Money:     money,
+		Language:  DefaultLanguage(),
 	}
 }
 
+// Returns the message with id in the language of the battle, see T
+func (b *Battle) T(id string, args ...interface{}) string {
+	return T(b.Language, id, args...)
+}
+
+// Returns the plural form for n of the message with id in the language of the battle, see TN
+func (b *Battle) TN(id string, n int, args ...interface{}) string {
+	return TN(b.Language, id, n, args...)
+}
+
+// Expires the pending battle so it can't be accepted anymore, b has to be locked unless lock is true
 func (b *Battle) Expire(lock bool) {
 	if lock {
 		b.Lock()
 		defer b.Unlock()
 	}
 
-	go SendMessage(b.Channel, "<@"+b.Initiator.Player.Id+"> Your battle with"+b.Defender.Player.Id+" Has expired")
+	b.Finished = true
+	b.UpdateChallenge(b.T("battle.expired", b.Initiator.Player.Id, b.Defender.Player.Id))
+}
+
+// Declines or cancels the battle, b has to be locked
+func (b *Battle) Decline(userID string) {
+	b.Finished = true
+
+	msg := b.T("battle.declined", b.Defender.Player.Id, b.Initiator.Player.Id)
+	if userID == b.Initiator.Player.Id {
+		msg = b.T("battle.cancelled", b.Initiator.Player.Id, b.Defender.Player.Id)
+	}
+
+	b.UpdateChallenge(msg)
+}
+
+// Returns the message requesting the battle, with accept and decline buttons
+func (b *Battle) ChallengeMessage() *discordgo.MessageSend {
+	return &discordgo.MessageSend{
+		Content: b.T("battle.challenge", b.Initiator.Player.Id, b.Defender.Player.Id, b.Money),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: b.T("battle.button.accept"), Style: discordgo.SuccessButton, CustomID: "battle:accept:" + b.Id},
+					discordgo.Button{Label: b.T("battle.button.decline"), Style: discordgo.DangerButton, CustomID: "battle:decline:" + b.Id},
+				},
+			},
+		},
+	}
+}
+
+// Replaces the challenge message with msg and removes the buttons, b has to be locked
+// Sends msg as a new message if there is no challenge message
+func (b *Battle) UpdateChallenge(msg string) {
+	if b.MessageID == "" {
+		sendAsync(func() { SendMessage(b.Channel, msg) })
+		return
+	}
+
+	edit := discordgo.NewMessageEdit(b.Channel, b.MessageID).SetContent(msg)
+	edit.Components = &[]discordgo.MessageComponent{}
+
+	sendAsync(func() {
+		_, err := transport.EditComplex(edit)
+		if err != nil {
+			log.Println("Error updating challenge message:", err)
+		}
+	})
+}
+
+// Handles the accept and decline buttons on challenge messages
+// args is the custom id split by ':', without the leading "battle"
+func HandleBattleComponent(user *discordgo.User, msg *discordgo.Message, args []string) error {
+	if len(args) < 2 {
+		return ErrBattleNotFound
+	}
+
+	switch args[0] {
+	case "accept":
+		return Battles.AcceptBattleByID(args[1], user.ID)
+	case "decline":
+		return Battles.DeclineBattleByID(args[1], user.ID)
+	}
+	return ErrBattleNotFound
 }
 
 func (b *Battle) CheckMoney() bool {
@@ -156,7 +364,7 @@ func (b *Battle) Battle() {
 	defer b.Defender.Player.Unlock()
 
 	if !b.CheckMoney() {
-		go SendMessage(b.Channel, "Not enough money to battle...")
+		sendAsync(func() { SendMessage(b.Channel, b.T("battle.no_money")) })
 		b.Finished = true
 		b.Running = false
 		return
@@ -199,31 +407,129 @@ func (b *Battle) End(winner, loser *BattlePlayer) {
 	xpRatio := float32(GetLevelFromXP(loser.Player.XP)) / float32(GetLevelFromXP(winner.Player.XP))
 	xpGain := int(xpRatio * 5)
 
-	b.Log = append(b.Log, fmt.Sprintf("**%s** Won against **%s** and earned %d$ and %d XP! (**%.2f** vs **%.2f**)\n", winner.Player.Name, loser.Player.Name, b.Money, xpGain, winner.Health, loser.Health))
+	summary := &BattleSummary{
+		Winner:       winner.Player.Name,
+		Loser:        loser.Player.Name,
+		Money:        b.Money,
+		XP:           xpGain,
+		WinnerHealth: winner.Health,
+		LoserHealth:  loser.Health,
+		Log:          b.Log,
+		Language:     b.Language,
+	}
 
+	// Only the money goes through the ledger, see LedgerChange
 	curLevel := GetLevelFromXP(winner.Player.XP)
 	winner.Player.XP += xpGain
 	newLevel := GetLevelFromXP(winner.Player.XP)
 	if curLevel != newLevel {
-		b.Log = append(b.Log, fmt.Sprintf("**%s** Reached Level **%d**!", winner.Player.Name, newLevel))
-	}
-
-	out := "**Battle Log**:\n"
-	for _, msg := range b.Log {
-		out += msg + "\n"
+		summary.NewLevel = newLevel
 	}
 
-	go SendMessage(b.Channel, out)
+	card := summary.Card()
+	sendAsync(func() { SendCard(b.Channel, card) })
 	b.Finished = true
 	b.Running = false
 
-	winner.Player.Money += b.Money
+	tx := Ledger.Begin(ReasonBattle, "")
+	tx.BattleId = b.Id
+	tx.AddMoney(winner.Player, b.Money)
 	if !b.IsMonster {
-		loser.Player.Money -= b.Money
+		tx.AddMoney(loser.Player, -b.Money)
 	}
+	tx.Commit()
 
 	winner.Player.Wins++
 	loser.Player.Losses++
+
+	winner.Player.AddBattleRecord(&BattleRecord{Time: time.Now(), Opponent: loser.Player.Name, OpponentId: loser.Player.Id, Won: true, Money: b.Money, XP: xpGain, Monster: b.IsMonster})
+	loser.Player.AddBattleRecord(&BattleRecord{Time: time.Now(), Opponent: winner.Player.Name, OpponentId: winner.Player.Id, Money: b.Money, Monster: b.IsMonster})
+}
+
+// How many battles are kept in Player.History
+const BattleHistorySize = 50
+
+// A finished battle as seen by one of the players
+type BattleRecord struct {
+	Time       time.Time
+	Opponent   string
+	OpponentId string // Empty for monsters
+	Won        bool
+	Money      int // Money won or lost, nothing is lost against monsters
+	XP         int
+	Monster    bool
+}
+
+// Adds r to the players history, dropping the oldest records over BattleHistorySize
+// The player needs to be locked
+func (p *Player) AddBattleRecord(r *BattleRecord) {
+	p.History = append(p.History, r)
+	if len(p.History) > BattleHistorySize {
+		p.History = p.History[len(p.History)-BattleHistorySize:]
+	}
+}
+
+// Returns the header and one line per battle in the players history, newest first, for a Paginator
+// The player needs to be read locked
+func (p *Player) HistoryPages(code string) (*Card, []string) {
+	card := &Card{
+		Title: T(code, "battles.title", p.Name),
+		Color: ColorBattle,
+	}
+
+	if len(p.History) < 1 {
+		card.Description = T(code, "battles.none")
+		return card, nil
+	}
+
+	rows := make([]string, 0, len(p.History))
+	for i := len(p.History) - 1; i >= 0; i-- {
+		r := p.History[i]
+		var line string
+		switch {
+		case r.Won:
+			line = T(code, "battles.won", r.Opponent, r.Money, r.XP)
+		case r.Monster:
+			line = T(code, "battles.lost_monster", r.Opponent)
+		default:
+			line = T(code, "battles.lost", r.Opponent, r.Money)
+		}
+		rows = append(rows, fmt.Sprintf("`%s` %s", r.Time.UTC().Format("2006-01-02 15:04"), line))
+	}
+	return card, rows
+}
+
+// The outcome of a finished battle
+type BattleSummary struct {
+	Winner string
+	Loser  string
+	Money  int
+	XP     int
+
+	WinnerHealth float32
+	LoserHealth  float32
+
+	// Level the winner reached, 0 if they did not level up
+	NewLevel int
+
+	Log []string
+
+	Language string
+}
+
+func (bs *BattleSummary) Card() *Card {
+	card := &Card{
+		Title:       T(bs.Language, "battle.log.title"),
+		Description: strings.Join(bs.Log, "\n"),
+		Color:       ColorBattle,
+	}
+
+	result := T(bs.Language, "battle.won", bs.Winner, bs.Loser, bs.Money, bs.XP, bs.WinnerHealth, bs.LoserHealth)
+	if bs.NewLevel != 0 {
+		result += "\n" + T(bs.Language, "battle.level_up", bs.Winner, bs.NewLevel)
+	}
+	card.AddField(T(bs.Language, "battle.result"), result, false)
+	return card
 }
 
 func (b *Battle) Turn(attacker, defender *BattlePlayer) {
@@ -231,7 +537,7 @@ func (b *Battle) Turn(attacker, defender *BattlePlayer) {
 	defender.NextTurn()
 
 	if attacker.StunDuration > 0 {
-		b.AppendLog(fmt.Sprintf("**%s** :zzz: (%d turn(s) left)", attacker.Player.Name, attacker.StunDuration))
+		b.AppendLog(b.TN("battle.log.stunned", attacker.StunDuration, attacker.Player.Name, attacker.StunDuration))
 		return
 	}
 
@@ -239,7 +545,7 @@ func (b *Battle) Turn(attacker, defender *BattlePlayer) {
 	defender.Defend()
 
 	if !b.SkipNextAttack {
-		b.DealDamage(attacker, defender, attacker.Damage(), "Basic Attack")
+		b.DealDamage(attacker, defender, attacker.Damage(), b.T("source.basic_attack"))
 	}
 
 	b.SkipNextAttack = false
@@ -255,14 +561,14 @@ func (b *Battle) DealDamage(attacker *BattlePlayer, defender *BattlePlayer, dama
 		// Check if attacker missed
 		missChance := attacker.MissChance()
 		if rand.Intn(100) < int(missChance) {
-			b.AppendLog(fmt.Sprintf("**%s** Missed **%s** with %s", attacker.Player.Name, defender.Player.Name, source))
+			b.AppendLog(b.T("battle.log.missed", attacker.Player.Name, defender.Player.Name, source))
 			return
 		}
 
 		// Check if defender dodged
 		dodgeChance := defender.DodgeChance()
 		if rand.Intn(100) < int(dodgeChance) {
-			b.AppendLog(fmt.Sprintf("**%s** Dodged **%s**'s %s", defender.Player.Name, attacker.Player.Name, source))
+			b.AppendLog(b.T("battle.log.dodged", defender.Player.Name, attacker.Player.Name, source))
 			return
 		}
 
@@ -271,22 +577,18 @@ func (b *Battle) DealDamage(attacker *BattlePlayer, defender *BattlePlayer, dama
 	originalHealth := defender.Health
 	defender.Health -= damage
 
-	action := ":crossed_swords:"
-	dealtHealed := "dealt"
-
+	id := "battle.log.damage"
 	if damage < 0 {
-		action = "💓"
-		dealtHealed = "healed"
+		id = "battle.log.heal"
 		damage = -damage
 	}
 
-	b.AppendLog(fmt.Sprintf("**%s** %s **%s** using **%s** and %s **%.1f** (%.2f:game_die:) (**%.1f** -> **%.1f:hearts:**)",
-		attacker.Player.Name, action, defender.Player.Name, source, dealtHealed, damage, modifier, originalHealth, defender.Health))
+	b.AppendLog(b.T(id, attacker.Player.Name, defender.Player.Name, source, damage, modifier, originalHealth, defender.Health))
 }
 
 func (b *Battle) Stun(attacker, defender *BattlePlayer, duration int, source string) {
 	defender.StunDuration += duration
-	b.AppendLog(fmt.Sprintf("**%s** Stunned **%s** for %d turn(s) using %s", attacker.Player.Name, defender.Player.Name, duration, source))
+	b.AppendLog(b.TN("battle.log.stun", duration, attacker.Player.Name, defender.Player.Name, duration, source))
 }
 
 func (b *Battle) AppendLog(msg string) {
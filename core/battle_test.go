@@ -0,0 +1,47 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiredBattleCantBeAccepted(t *testing.T) {
+	newTestTransport(t, "")
+
+	bm := &BattleManager{Battles: make([]*Battle, 0)}
+	battle := NewBattle(&Player{Id: "2", Name: "tester"}, &Player{Id: "3", Name: "defender"}, 10, "channel")
+	battle.Initiated = time.Now().Add(-2 * time.Minute)
+	if !bm.MaybeAddBattle(battle) {
+		t.Fatal("MaybeAddBattle refused the battle")
+	}
+
+	bm.Lock()
+	bm.CheckBattles()
+	bm.Unlock()
+	shutdown.sending.Wait()
+
+	battle.RLock()
+	finished := battle.Finished
+	battle.RUnlock()
+	if !finished {
+		t.Error("the expired battle isn't finished")
+	}
+
+	err := bm.AcceptBattleByID(battle.Id, "3")
+	if err != ErrBattleNotFound {
+		t.Errorf("accepting the expired battle: got error %v, want ErrBattleNotFound", err)
+	}
+
+	// A battle accepted right before it expired doesn't start
+	bm.Lock()
+	bm.acceptBattle(battle)
+	bm.Unlock()
+	shutdown.running.Wait()
+
+	battle.RLock()
+	turns := battle.CurTurn
+	battle.RUnlock()
+	if turns != 0 {
+		t.Errorf("the expired battle was started and ran %d turns", turns)
+	}
+}
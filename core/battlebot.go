@@ -1,14 +1,16 @@
 package core
 
 import (
-	"errors"
 	"flag"
 	"github.com/bwmarrin/discordgo"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
 	"runtime/debug"
 	"strings"
+	"syscall"
 )
 
 const (
@@ -18,18 +20,29 @@ const (
 var (
 	flagToken string
 	flagDebug bool
-	dgo       *discordgo.Session
 	Commands  []*CommandDef = make([]*CommandDef, 0)
 	ItemTypes []*ItemType   = make([]*ItemType, 0)
 )
 
-func init() {
+// Registers the bots flags and parses the command line, programs using core call it before anything else
+// core doesn't parse flags when it's loaded so it can be imported by tests
+func ParseFlags() {
+	if flag.Parsed() {
+		return
+	}
+
 	flag.StringVar(&flagToken, "t", "", "Token to use")
 	flag.BoolVar(&flagDebug, "d", false, "Set to turn on debug info, such as pprof http server")
+	flag.StringVar(&flagOwners, "owners", "", "Comma separated user ids of the bot owners, required")
+	flag.IntVar(&Cooldowns.RateLimit, "ratelimit", 0, "Max commands per user per minute, 0 for no limit")
+	flag.StringVar(&flagLanguage, "lang", FallbackLanguage, "Language used when neither the user nor the server has picked one")
+	flag.StringVar(&flagLangDir, "langdir", "", "Directory with extra or updated language files, these override the bundled ones")
+	flag.StringVar(&flagStore, "store", "json", "Where players are saved: json (one file) or bolt (embedded database)")
+	flag.StringVar(&flagStorePath, "storepath", "", "Path of the players file or database, defaults to players.json or players.db")
+	flag.IntVar(&flagBackups, "backups", 5, "Number of timestamped backups of the json players file to keep")
+	flag.StringVar(&flagLedger, "ledger", "ledger.jsonl", "Path of the append-only log of money and item movements")
 
-	if !flag.Parsed() {
-		flag.Parse()
-	}
+	flag.Parse()
 }
 
 func PanicErr(err error) {
@@ -41,19 +54,40 @@ func PanicErr(err error) {
 func Run() {
 	log.Println("Launching " + VERSION)
 
+	if strings.TrimSpace(flagOwners) == "" {
+		log.Fatal("No bot owners set, start the bot with -owners <your user id>")
+	}
+
 	session, err := discordgo.New(flagToken)
 	PanicErr(err)
 
+	// Message content is needed for prefix commands
+	session.Identify.Intents = discordgo.IntentsAllWithoutPrivileged | discordgo.IntentMessageContent
+
+	err = Guilds.Load()
+	if err != nil {
+		log.Println("Failed loading guild settings:", err)
+	}
+
+	LoadLanguageDir()
+
+	Players.Store, err = OpenConfiguredStore()
+	PanicErr(err)
+
+	err = OpenConfiguredLedger()
+	PanicErr(err)
+
 	session.AddHandler(MessageHandler)
 	session.AddHandler(HandleReady)
 	session.AddHandler(HandleServerJoin)
-	dgo = session
+	session.AddHandler(HandleInteractionCreate)
+	SetTransport(NewDiscordTransport(session))
 	err = session.Open()
 	PanicErr(err)
 
 	log.Println("Launched!")
 	go Battles.Run()
-	go Players.Run()
+	Players.Start()
 
 	if flagDebug {
 		go func() {
@@ -61,7 +95,29 @@ func Run() {
 		}()
 	}
 
-	select {}
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	log.Printf("Received %s, shutting down (send it again to quit right away)", sig)
+
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s again, quitting without finishing the shutdown", sig)
+		os.Exit(1)
+	}()
+
+	shutdownErr := Shutdown()
+
+	err = session.Close()
+	if err != nil {
+		log.Println("Failed closing the discord session:", err)
+	}
+
+	if shutdownErr != nil {
+		log.Println("Shut down with errors, some changes may not have been saved:", shutdownErr)
+	} else {
+		log.Println("Shut down cleanly")
+	}
 }
 
 // Registers commands to the command system
@@ -70,6 +126,9 @@ func RegisterCommands(cmds ...*CommandDef) {
 	if Commands == nil {
 		Commands = make([]*CommandDef, 0, len(cmds))
 	}
+	for _, cmd := range cmds {
+		cmd.linkSubcommands()
+	}
 	Commands = append(Commands, cmds...)
 }
 
@@ -87,75 +146,203 @@ func MessageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return // Wait till we have state initialized
 	}
 
-	if len(m.Mentions) == 0 {
+	if m.Author == nil || m.Author.Bot {
 		return
 	}
 
-	if strings.Index(m.Content, "<@"+s.State.User.ID) == 0 || strings.Index(m.Content, "<@!"+s.State.User.ID) == 0 {
+	if _, ok := StripCommandPrefix(m.Content, m.GuildID); ok {
 		err := HandleCommand(m.Content, m)
-		if err != nil {
-			SendMessage(m.ChannelID, "Error: "+err.Error()+" See `@bot help` for more info")
-			log.Println("Error handling command:", err)
+		if err == nil {
+			return
+		}
+
+		code := LanguageFor(m.Author.ID, m.GuildID)
+		if IsNoticeError(err) {
+			SendMessage(m.ChannelID, "<@"+m.Author.ID+"> "+LocalizeError(code, err))
+			return
 		}
+
+		SendMessage(m.ChannelID, T(code, "error.command_failed", LocalizeError(code, err)))
+		log.Println("Error handling command:", err)
 	}
 }
 
 var (
-	ErrCommandEmpty    = errors.New("No comand specified")
-	ErrCommandNotFound = errors.New("Command not found :'(")
+	ErrCommandEmpty    = NewLocaleError("error.command_empty")
+	ErrCommandNotFound = NewLocaleError("error.command_not_found")
+	ErrCommandPanic    = NewLocaleError("error.panic")
 )
 
-func HandleCommand(cmd string, m *discordgo.MessageCreate) error {
+func HandleCommand(cmd string, m *discordgo.MessageCreate) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			stack := string(debug.Stack())
-			SendMessage(m.ChannelID, "Panic when handling Command!! ```\n"+stack+"\n```")
-			log.Println("Recovered from panic ", r, "\n", m.Content, "\n", stack)
+			// The stack is only logged, it can contain details users shouldn't see
+			log.Println("Recovered from panic ", r, "\n", m.Content, "\n", string(debug.Stack()))
+			err = ErrCommandPanic
 		}
 	}()
 
-	// Remove our mention
-	cmd = strings.Replace(cmd, "<@"+dgo.State.User.ID+">", "", 1)
-	cmd = strings.Replace(cmd, "<@!"+dgo.State.User.ID+">", "", 1)
-	cmd = strings.TrimSpace(cmd)
+	// Remove our mention or the guild prefix
+	cmd, _ = StripCommandPrefix(strings.TrimSpace(cmd), m.GuildID)
+
+	tokens, err := Tokenize(cmd)
+	if err != nil {
+		return err
+	}
 
-	fields := strings.Fields(cmd)
-	if len(fields) < 1 {
+	if len(tokens) < 1 {
 		return ErrCommandEmpty
 	}
 
-	cmdName := strings.ToLower(fields[0])
+	def, args := ResolveCommand(tokens)
+	if def == nil {
+		return WithSuggestion(ErrCommandNotFound, tokens[0].Value, CommandNames(GetPermissionLevel(m)))
+	}
 
+	if def.RunFunc == nil {
+		// A command group invoked without a valid subcommand, the middlewares check it can be used before the help is shown
+		return RunInvocation(&Invocation{
+			Cmd:     def,
+			Message: m,
+			parse: func() (*ParsedCommand, error) {
+				if len(args) > 0 {
+					err := NewLocaleError("error.unknown_subcommand", args[0].Value, def.FullName(), strings.Join(def.SubcommandNames(), ", "))
+					return nil, WithSuggestion(err, args[0].Value, def.SubcommandNames())
+				}
+				return &ParsedCommand{Name: def.FullName(), Cmd: def}, nil
+			},
+			run: func(ctx *CommandContext) error {
+				return SendHelp(ctx, def.FullName())
+			},
+		})
+	}
+
+	return RunInvocation(&Invocation{
+		Cmd:     def,
+		Message: m,
+		parse: func() (*ParsedCommand, error) {
+			return ParseCommand(args, m, def)
+		},
+	})
+}
+
+// Returns the top level command with name or alias, or the subcommand with name as a root alias, nil if none
+func FindCommand(name string) *CommandDef {
 	for _, v := range Commands {
+		if v.Name == name {
+			return v
+		}
 
-		match := v.Name == cmdName
-		if !match {
-			for _, alias := range v.Aliases {
-				if alias == cmdName {
-					match = true
-					break
-				}
+		for _, alias := range v.Aliases {
+			if alias == name {
+				return v
 			}
 		}
+	}
 
-		if match {
-			parsed, err := ParseCommand(cmd, m, v)
-			if err != nil {
-				return err
-			}
+	for _, v := range Commands {
+		if cmd := findRootAlias(v.Subcommands, name); cmd != nil {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+// Returns the categories of all commands, in the order they were added
+func Categories() []string {
+	out := make([]string, 0)
+	for _, v := range Commands {
+		if v.Category != "" && !stringInSlice(v.Category, out) {
+			out = append(out, v.Category)
+		}
+	}
+	return out
+}
+
+// Returns the command category matching name, ignoring case, with a suggestion if there is none
+func FindCategory(name string) (string, error) {
+	categories := Categories()
+	for _, v := range categories {
+		if strings.EqualFold(v, name) {
+			return v, nil
+		}
+	}
+
+	err := NewLocaleError("error.unknown_category", name, strings.Join(categories, ", "))
+	return "", WithSuggestion(err, name, categories)
+}
+
+// Returns the names, aliases and root aliases of the commands usable at level
+func CommandNames(level PermissionLevel) []string {
+	out := make([]string, 0, len(Commands))
+	for _, v := range Commands {
+		if v.RequiredPermission() <= level {
+			out = append(out, v.Name)
+			out = append(out, v.Aliases...)
+		}
+		out = append(out, rootAliasNames(v.Subcommands, level)...)
+	}
+	return out
+}
+
+func rootAliasNames(cmds []*CommandDef, level PermissionLevel) []string {
+	out := make([]string, 0)
+	for _, v := range cmds {
+		if v.RequiredPermission() <= level {
+			out = append(out, v.RootAliases...)
+		}
+		out = append(out, rootAliasNames(v.Subcommands, level)...)
+	}
+	return out
+}
 
-			if v.RunFunc != nil {
-				v.RunFunc(parsed, m)
+func findRootAlias(cmds []*CommandDef, name string) *CommandDef {
+	for _, v := range cmds {
+		for _, alias := range v.RootAliases {
+			if alias == name {
+				return v
 			}
-			return nil
+		}
+
+		if cmd := findRootAlias(v.Subcommands, name); cmd != nil {
+			return cmd
 		}
 	}
+	return nil
+}
 
-	return ErrCommandNotFound
+// Walks the command tree using the leading tokens, returning the deepest matching command and the remaining tokens
+func ResolveCommand(tokens []*Token) (*CommandDef, []*Token) {
+	if len(tokens) < 1 {
+		return nil, tokens
+	}
+
+	def := FindCommand(strings.ToLower(tokens[0].Value))
+	if def == nil {
+		return nil, tokens
+	}
+
+	tokens = tokens[1:]
+	for len(tokens) > 0 && !tokens[0].Quoted {
+		sub := def.FindSubcommand(strings.ToLower(tokens[0].Value))
+		if sub == nil {
+			break
+		}
+		def = sub
+		tokens = tokens[1:]
+	}
+
+	return def, tokens
 }
 
 func HandleReady(s *discordgo.Session, r *discordgo.Ready) {
 	log.Println("Ready received! Connected to", len(s.State.Guilds), "Guilds")
+
+	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", ApplicationCommands())
+	if err != nil {
+		log.Println("Failed registering application commands:", err)
+	}
 }
 
 func HandleServerJoin(s *discordgo.Session, g *discordgo.GuildCreate) {
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"context"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+var testEchoCommand = &CommandDef{
+	Name:         "echo",
+	Description:  "Replies with its argument",
+	RequiredArgs: 1,
+	Arguments: []*ArgumentDef{
+		&ArgumentDef{Name: "text", Type: ArgumentTypeString, Greedy: true},
+	},
+	RunFunc: func(ctx *CommandContext) error {
+		return ctx.Reply("echo: " + ctx.Arg(0).Str())
+	},
+}
+
+var testGroupCommand = &CommandDef{
+	Name:        "testgroup",
+	Description: "A command group",
+	Subcommands: []*CommandDef{
+		&CommandDef{
+			Name:        "sub",
+			Description: "A subcommand",
+			RunFunc: func(ctx *CommandContext) error {
+				return ctx.Reply("sub")
+			},
+		},
+	},
+}
+
+var testPanicCommand = &CommandDef{
+	Name: "testpanic",
+	RunFunc: func(ctx *CommandContext) error {
+		panic("test panic")
+	},
+}
+
+func init() {
+	RegisterCommands(testEchoCommand, testGroupCommand, testPanicCommand)
+}
+
+// Sets up a MemoryTransport with one user and returns it and a message from that user
+func newTestTransport(t *testing.T, content string) (*MemoryTransport, *discordgo.MessageCreate) {
+	mt := NewMemoryTransport(&discordgo.User{ID: "1", Username: "BattleBot", Bot: true})
+	user := &discordgo.User{ID: "2", Username: "tester"}
+	mt.AddUser(user)
+
+	old := transport
+	SetTransport(mt)
+	t.Cleanup(func() { SetTransport(old) })
+
+	return mt, &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        "in1",
+			ChannelID: "channel",
+			GuildID:   "guild",
+			Content:   content,
+			Author:    user,
+		},
+	}
+}
+
+func TestHandleCommandReplies(t *testing.T) {
+	mt, m := newTestTransport(t, `<@1> echo "hello there"`)
+
+	err := HandleCommand(m.Content, m)
+	if err != nil {
+		t.Fatal("HandleCommand:", err)
+	}
+
+	messages := mt.ChannelMessages("channel")
+	if len(messages) != 1 {
+		t.Fatalf("got %d replies, want 1", len(messages))
+	}
+	if messages[0].Content != "echo: hello there" {
+		t.Errorf("reply is %q, want %q", messages[0].Content, "echo: hello there")
+	}
+}
+
+func TestHandleCommandNotFound(t *testing.T) {
+	mt, m := newTestTransport(t, "<@1> ehco hi")
+
+	err := HandleCommand(m.Content, m)
+	if err == nil {
+		t.Fatal("unknown command didn't return an error")
+	}
+	if !strings.Contains(LocalizeError(FallbackLanguage, err), "echo") {
+		t.Errorf("error %q doesn't suggest echo", LocalizeError(FallbackLanguage, err))
+	}
+	if n := len(mt.ChannelMessages("channel")); n != 0 {
+		t.Errorf("got %d replies, want none", n)
+	}
+}
+
+func TestHandleCommandPanic(t *testing.T) {
+	mt, m := newTestTransport(t, "<@1> testpanic")
+
+	err := HandleCommand(m.Content, m)
+	if err != ErrCommandPanic {
+		t.Fatalf("got error %v, want ErrCommandPanic", err)
+	}
+	if n := len(mt.ChannelMessages("channel")); n != 0 {
+		t.Errorf("got %d messages, the panic shouldn't be sent to the channel", n)
+	}
+}
+
+func TestHandleCommandGroupHelp(t *testing.T) {
+	mt, m := newTestTransport(t, "<@1> testgroup")
+
+	err := HandleCommand(m.Content, m)
+	if err != nil {
+		t.Fatal("HandleCommand:", err)
+	}
+	if n := len(mt.ChannelMessages("channel")); n != 1 {
+		t.Fatalf("got %d replies, want the help", n)
+	}
+
+	m.Content = "<@1> testgroup nope"
+	err = HandleCommand(m.Content, m)
+	if localeErrorID(err) != "error.unknown_subcommand" {
+		t.Errorf("unknown subcommand: got error %v", err)
+	}
+}
+
+func TestSendHelp(t *testing.T) {
+	mt, m := newTestTransport(t, "")
+	ctx := NewCommandContext(context.Background(), &ParsedCommand{}, m)
+
+	cases := []struct {
+		cmd string
+		err string // Id of the expected error, empty if help is sent
+	}{
+		{cmd: "", err: ""},
+		{cmd: "echo", err: ""},
+		{cmd: `"testgroup" sub`, err: ""},
+		{cmd: "ehco", err: "help.unknown_command"},
+		{cmd: "echo more", err: "help.unknown_command"},
+		{cmd: `"echo`, err: "parse.unterminated_quote"},
+	}
+
+	for _, c := range cases {
+		before := len(mt.ChannelMessages("channel"))
+		err := SendHelp(ctx, c.cmd)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", c.cmd, err)
+			} else if len(mt.ChannelMessages("channel")) != before+1 {
+				t.Errorf("%s: no help was sent", c.cmd)
+			}
+			continue
+		}
+
+		if localeErrorID(err) != c.err {
+			t.Errorf("%s: got error %v, want %s", c.cmd, err, c.err)
+		}
+	}
+}
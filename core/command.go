@@ -1,45 +1,240 @@
 package core
 
 import (
-	"errors"
 	"fmt"
 	"github.com/bwmarrin/discordgo"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type CommandDef struct {
-	Name    string
-	Aliases []string
+	Name     string
+	Aliases  []string
+	Category string
 
 	Description  string
 	RequiredArgs int
 	Arguments    []*ArgumentDef
-	RunFunc      func(cmd *ParsedCommand, m *discordgo.MessageCreate)
-	HideFromHelp bool
+	Flags        []*ArgumentDef                  // Optional `--name value` arguments, can be placed anywhere
+	Examples     []string                        // Example invocations shown in help, without the mention or prefix
+	Cooldown     time.Duration                   // Per user cooldown, 0 for none
+	RunFunc      func(ctx *CommandContext) error // Errors are shown to the user
+
+	// Required permission level, the command is hidden from help for anyone below it
+	Permission PermissionLevel
+
+	// Nested commands, e.g `list` and `buy` under `shop`
+	// If no subcommand matches the command itself is run, or its help is shown if it has no RunFunc
+	Subcommands []*CommandDef
+
+	// Names that invoke this subcommand directly without its parents, e.g `buy` for `shop buy`
+	RootAliases []string
+
+	// Can't be disabled per guild, applies to the subcommands as well
+	AlwaysEnabled bool
+
+	parent *CommandDef
+}
+
+// Returns the command this is a subcommand of, nil for top level commands
+func (c *CommandDef) Parent() *CommandDef {
+	return c.parent
+}
+
+// Returns the names of the command and its parents, e.g `shop buy`
+func (c *CommandDef) FullName() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.FullName() + " " + c.Name
+}
+
+// Returns the highest permission level required by the command or any of its parents
+func (c *CommandDef) RequiredPermission() PermissionLevel {
+	level := c.Permission
+	if c.parent != nil {
+		if parentLevel := c.parent.RequiredPermission(); parentLevel > level {
+			level = parentLevel
+		}
+	}
+	return level
+}
+
+// Returns false if the command or any of its parents are AlwaysEnabled
+func (c *CommandDef) CanDisable() bool {
+	for cmd := c; cmd != nil; cmd = cmd.parent {
+		if cmd.AlwaysEnabled {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the subcommand with name or alias, nil if none
+func (c *CommandDef) FindSubcommand(name string) *CommandDef {
+	for _, v := range c.Subcommands {
+		if v.Name == name {
+			return v
+		}
+
+		for _, alias := range v.Aliases {
+			if alias == name {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the names of the subcommands
+func (c *CommandDef) SubcommandNames() []string {
+	out := make([]string, len(c.Subcommands))
+	for k, v := range c.Subcommands {
+		out[k] = v.Name
+	}
+	return out
+}
+
+// Sets the parent of all subcommands, and the category to the parents if not set
+func (c *CommandDef) linkSubcommands() {
+	for _, sub := range c.Subcommands {
+		sub.parent = c
+		if sub.Category == "" {
+			sub.Category = c.Category
+		}
+		sub.linkSubcommands()
+	}
 }
 
+// Returns a one line summary of the command
 func (c *CommandDef) String() string {
 	aliasesString := ""
-
 	if len(c.Aliases) > 0 {
-		for k, v := range c.Aliases {
-			if k != 0 {
-				aliasesString += "/"
-			}
-			aliasesString += v
+		aliasesString = " (" + strings.Join(c.Aliases, "/") + ")"
+	}
+
+	return fmt.Sprintf("**%s**%s: %s.", c.FullName(), aliasesString, c.Description)
+}
+
+// Returns the usage line, required arguments are in <> and optional in []
+func (c *CommandDef) Usage() string {
+	out := c.FullName()
+	if len(c.Subcommands) > 0 && c.RunFunc == nil {
+		return out + " <" + strings.Join(c.SubcommandNames(), "|") + ">"
+	}
+
+	for k, arg := range c.Arguments {
+		name := arg.Name
+		if arg.Greedy {
+			name += "..."
 		}
-		aliasesString = "(" + aliasesString + ")"
+
+		if k < c.RequiredArgs {
+			out += " <" + name + ">"
+		} else {
+			out += " [" + name + "]"
+		}
+	}
+
+	for _, flag := range c.Flags {
+		out += " [--" + flag.Name + " <" + flag.Name + ">]"
+	}
+	return out
+}
+
+// Returns the message id prefix for translations of the command, e.g command.shop.buy
+func (c *CommandDef) messageID() string {
+	return "command." + strings.Replace(c.FullName(), " ", ".", -1)
+}
+
+// Returns the description in language code, from the command.<full name>.description message if translated
+func (c *CommandDef) LocalDescription(code string) string {
+	return TFallback(code, c.messageID()+".description", c.Description)
+}
+
+// Returns a card with detailed help for the command in language code
+// Subcommands above level are left out
+func (c *CommandDef) HelpCard(level PermissionLevel, code string) *Card {
+	card := &Card{
+		Title:       "`" + c.Usage() + "`",
+		Description: c.LocalDescription(code),
+		Color:       ColorStats,
 	}
 
-	out := fmt.Sprintf("**%s**%s: %s.", c.Name, aliasesString, c.Description)
 	if len(c.Arguments) > 0 {
-		out += fmt.Sprintf("( %v )", c.Arguments)
-		for _, v := range c.Arguments {
-			out += fmt.Sprintf("\n     \\* %s - %s", v.String(), v.Description)
+		card.AddField(T(code, "help.arguments"), c.argumentsHelp(c.Arguments, c.RequiredArgs, code), false)
+	}
+
+	if len(c.Flags) > 0 {
+		card.AddField(T(code, "help.flags"), c.argumentsHelp(c.Flags, 0, code), false)
+	}
+
+	if len(c.Subcommands) > 0 {
+		subcommands := ""
+		for _, sub := range c.Subcommands {
+			if sub.Permission <= level {
+				subcommands += " - `" + sub.Usage() + "` " + sub.LocalDescription(code) + "\n"
+			}
+		}
+		if subcommands != "" {
+			card.AddField(T(code, "help.subcommands"), strings.TrimSuffix(subcommands, "\n"), false)
 		}
 	}
-	return out
+
+	if len(c.Aliases) > 0 {
+		card.AddField(T(code, "help.aliases"), strings.Join(c.Aliases, ", "), false)
+	}
+
+	if len(c.RootAliases) > 0 {
+		card.AddField(T(code, "help.shortcuts"), strings.Join(c.RootAliases, ", "), false)
+	}
+
+	if c.Cooldown > 0 {
+		card.AddField(T(code, "help.cooldown"), c.Cooldown.String(), false)
+	}
+
+	if level := c.RequiredPermission(); level > PermissionUser {
+		card.AddField(T(code, "help.permission"), level.LocalName(code), false)
+	}
+
+	if len(c.Examples) > 0 {
+		examples := ""
+		for _, v := range c.Examples {
+			examples += "`" + v + "`\n"
+		}
+		card.AddField(T(code, "help.examples"), strings.TrimSuffix(examples, "\n"), false)
+	}
+
+	return card
+}
+
+// Argument descriptions are translated with the command.<full name>.arg.<argument name> message
+func (c *CommandDef) argumentsHelp(args []*ArgumentDef, required int, code string) string {
+	out := ""
+	for k, arg := range args {
+		out += " - " + arg.String()
+		if k >= required {
+			out += " " + T(code, "help.optional")
+		}
+
+		key := strings.ToLower(strings.Replace(arg.Name, " ", "_", -1))
+		description := TFallback(code, c.messageID()+".arg."+key, arg.Description)
+		if description != "" {
+			out += " - " + description
+		}
+
+		if len(arg.Choices) > 0 {
+			choices := make([]string, len(arg.Choices))
+			for i, v := range arg.Choices {
+				choices[i] = v.String()
+			}
+			out += " " + T(code, "help.choices", strings.Join(choices, ", "))
+		}
+		out += "\n"
+	}
+	return strings.TrimSuffix(out, "\n")
 }
 
 type ArgumentType int
@@ -48,6 +243,11 @@ const (
 	ArgumentTypeString ArgumentType = iota
 	ArgumentTypeNumber
 	ArgumentTypeUser
+	ArgumentTypeEnum          // One of ArgumentDef.Choices
+	ArgumentTypeItem          // An item type by id or name
+	ArgumentTypeInventorySlot // A slot in the callers inventory
+	ArgumentTypeRole          // A role mention or id
+	ArgumentTypeChannel       // A channel mention or id
 )
 
 func (a ArgumentType) String() string {
@@ -58,6 +258,16 @@ func (a ArgumentType) String() string {
 		return "Number"
 	case ArgumentTypeUser:
 		return "@User"
+	case ArgumentTypeEnum:
+		return "Choice"
+	case ArgumentTypeItem:
+		return "Item"
+	case ArgumentTypeInventorySlot:
+		return "Inventory slot"
+	case ArgumentTypeRole:
+		return "@Role"
+	case ArgumentTypeChannel:
+		return "#Channel"
 	}
 	return "???"
 }
@@ -66,6 +276,12 @@ type ArgumentDef struct {
 	Name        string
 	Description string
 	Type        ArgumentType
+
+	// Allowed values for ArgumentTypeEnum
+	Choices []*ArgumentChoice
+
+	// Consumes the rest of the line, only valid for the last argument
+	Greedy bool
 }
 
 func (a *ArgumentDef) String() string {
@@ -73,14 +289,57 @@ func (a *ArgumentDef) String() string {
 	return a.Name + ":" + a.Type.String() + ""
 }
 
+// A valid value for an enum argument
+type ArgumentChoice struct {
+	Name    string
+	Aliases []string
+	Value   interface{}
+}
+
+func (c *ArgumentChoice) String() string {
+	if len(c.Aliases) < 1 {
+		return c.Name
+	}
+	return c.Name + " (" + strings.Join(c.Aliases, "/") + ")"
+}
+
+// Returns the choice matching raw by name or alias, what is used in the error message
+func FindChoice(choices []*ArgumentChoice, what, raw string) (*ArgumentChoice, error) {
+	for _, choice := range choices {
+		if strings.EqualFold(choice.Name, raw) {
+			return choice, nil
+		}
+		for _, alias := range choice.Aliases {
+			if strings.EqualFold(alias, raw) {
+				return choice, nil
+			}
+		}
+	}
+
+	valid := make([]string, len(choices))
+	names := make([]string, 0, len(choices))
+	for k, v := range choices {
+		valid[k] = v.String()
+		names = append(names, v.Name)
+		names = append(names, v.Aliases...)
+	}
+	err := NewLocaleError("parse.unknown_choice", what, raw, strings.Join(valid, ", "))
+	return nil, WithSuggestion(err, raw, names)
+}
+
 type ParsedArgument struct {
 	Raw    string
 	Parsed interface{}
 }
 
 func (p *ParsedArgument) Int() int {
-	val, _ := p.Parsed.(float64)
-	return int(val)
+	switch val := p.Parsed.(type) {
+	case float64:
+		return int(val)
+	case int:
+		return val
+	}
+	return 0
 }
 
 func (p *ParsedArgument) Str() string {
@@ -98,109 +357,367 @@ func (p *ParsedArgument) DiscordUser() *discordgo.User {
 	return val
 }
 
-func (p *ParsedArgument) GetCreatePlayer() *Player {
+func (p *ParsedArgument) ItemType() *ItemType {
+	val, _ := p.Parsed.(*ItemType)
+	return val
+}
+
+// Returns the player of the user in economy, creating it if it doesn't exist
+func (p *ParsedArgument) GetCreatePlayer(economy string) *Player {
 	user := p.DiscordUser()
-	return Players.GetCreatePlayer(user.ID, user.Username)
+	return Players.GetCreatePlayer(economy, user.ID, user.Username)
 }
 
 type ParsedCommand struct {
-	Name string
-	Cmd  *CommandDef
-	Args []*ParsedArgument
+	Name  string
+	Cmd   *CommandDef
+	Args  []*ParsedArgument
+	Flags map[string]*ParsedArgument
+}
+
+// Returns the argument at index, nil if it wasn't given
+func (p *ParsedCommand) Arg(index int) *ParsedArgument {
+	if index < 0 || index >= len(p.Args) {
+		return nil
+	}
+	return p.Args[index]
+}
+
+// Returns the flag with name, nil if not set
+func (p *ParsedCommand) Flag(name string) *ParsedArgument {
+	return p.Flags[name]
+}
+
+// Returns the page from the page flag or argument, 1 if not given
+func (p *ParsedCommand) Page() int {
+	if flag := p.Flag(PageArgument.Name); flag != nil {
+		return flag.Int()
+	}
+
+	if p.Cmd != nil {
+		for k, arg := range p.Cmd.Arguments {
+			if arg == PageArgument {
+				if parsed := p.Arg(k); parsed != nil {
+					return parsed.Int()
+				}
+			}
+		}
+	}
+	return 1
+}
+
+// Returns the command as it would have been typed
+func (p *ParsedCommand) String() string {
+	out := p.Name
+	for _, v := range p.Args {
+		if v != nil {
+			out += " " + quoteField(v.Raw)
+		}
+	}
+	for name, v := range p.Flags {
+		out += " --" + name + " " + quoteField(v.Raw)
+	}
+	return out
 }
 
 var (
-	ErrIncorrectNumArgs    = errors.New("Icorrect number of arguments")
-	ErrDiscordUserNotFound = errors.New("Discord user not found")
+	ErrIncorrectNumArgs    = NewLocaleError("parse.incorrect_num_args")
+	ErrTooManyArgs         = NewLocaleError("parse.too_many_args")
+	ErrUnterminatedQuote   = NewLocaleError("parse.unterminated_quote")
+	ErrDiscordUserNotFound = NewLocaleError("parse.user_not_found")
 )
 
-func ParseCommand(raw string, m *discordgo.MessageCreate, target *CommandDef) (*ParsedCommand, error) {
-	// No arguments passed
-	if len(target.Arguments) < 1 {
-		return &ParsedCommand{
-			Name: target.Name,
-			Cmd:  target,
-		}, nil
+type Token struct {
+	Value  string
+	Quoted bool // True if any part of the token was quoted
+
+	// The unparsed input from the start of the token to the end, for greedy arguments
+	Rest string
+}
+
+// Splits raw into tokens seperated by whitespace
+// Text within double quotes, or single quotes at the start of a token, is kept as one token and \ escapes the next character
+// Single quotes anywhere else are kept as they are, so apostrophes like in Dragon's Tooth work unquoted
+func Tokenize(raw string) ([]*Token, error) {
+	tokens := make([]*Token, 0)
+
+	var cur *Token
+	var quote rune
+	escaped := false
+
+	start := func(i int) {
+		if cur == nil {
+			cur = &Token{Rest: strings.TrimRightFunc(raw[i:], unicode.IsSpace)}
+		}
+	}
+
+	for i, r := range raw {
+		if escaped {
+			cur.Value += string(r)
+			escaped = false
+			continue
+		}
+
+		switch {
+		case r == '\\':
+			start(i)
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.Value += string(r)
+			}
+		case r == '"' || (r == '\'' && cur == nil):
+			start(i)
+			quote = r
+			cur.Quoted = true
+		case unicode.IsSpace(r):
+			if cur != nil {
+				tokens = append(tokens, cur)
+				cur = nil
+			}
+		default:
+			start(i)
+			cur.Value += string(r)
+		}
+	}
+
+	if quote != 0 {
+		return nil, ErrUnterminatedQuote
+	}
+
+	if cur != nil {
+		tokens = append(tokens, cur)
+	}
+	return tokens, nil
+}
+
+// Quotes field if it would otherwise be split up by Tokenize
+func quoteField(field string) string {
+	if field != "" && !strings.ContainsAny(field, " \t\n\"'\\") {
+		return field
 	}
+	return strconv.Quote(field)
+}
 
-	fields := strings.Fields(raw)
+// Parses the arguments and flags for target, tokens should not include the command names (see ResolveCommand)
+func ParseCommand(tokens []*Token, m *discordgo.MessageCreate, target *CommandDef) (*ParsedCommand, error) {
+	parsed := &ParsedCommand{
+		Name: target.FullName(),
+		Cmd:  target,
+	}
 
-	if len(fields)-1 < target.RequiredArgs {
+	fields, err := parseFlags(tokens, m, target, parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) < target.RequiredArgs {
 		return nil, ErrIncorrectNumArgs
 	}
 
-	fields = fields[1:]
+	if len(fields) > len(target.Arguments) {
+		if len(target.Arguments) < 1 || !target.Arguments[len(target.Arguments)-1].Greedy {
+			return nil, ErrTooManyArgs
+		}
+	}
+
+	// No arguments passed
+	if len(target.Arguments) < 1 {
+		return parsed, nil
+	}
 
 	// Parse the arguments
-	parsedArgs := make([]*ParsedArgument, len(target.Arguments))
-	for k, field := range fields {
-		var err error
-		var val interface{}
-
-		switch target.Arguments[k].Type {
-		case ArgumentTypeNumber:
-			val, err = strconv.ParseFloat(field, 64)
-		case ArgumentTypeString:
-			val = field
-		case ArgumentTypeUser:
-			if strings.Index(field, "<@") == 0 {
-				// Direct mention
-				id := field[2 : len(field)-1]
-				if id[0] == '!' {
-					id = id[1:]
-				}
+	parsed.Args = make([]*ParsedArgument, len(target.Arguments))
+	for k, token := range fields {
+		def := target.Arguments[k]
+		field := token.Value
+		if def.Greedy && k < len(fields)-1 {
+			field = greedyField(tokens, fields[k:])
+		}
 
-				for _, v := range m.Mentions {
-					if id == v.ID {
-						val = v
-						break
-					}
-				}
-			} else {
-				// Search for username
-				val, err = FindDiscordUser(field, m)
+		parsedArg, err := ParseArgument(def, field, m)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed.Args[k] = parsedArg
+		if def.Greedy {
+			break
+		}
+	}
+
+	return parsed, nil
+}
+
+// Returns the text of a greedy argument made up of rest, the last fields of tokens
+// That's the input as it was typed, unless flags were mixed in and it has to be pieced together from the tokens
+func greedyField(tokens, rest []*Token) string {
+	if tokens[len(tokens)-len(rest)] == rest[0] {
+		return rest[0].Rest
+	}
+
+	values := make([]string, len(rest))
+	for k, v := range rest {
+		values[k] = v.Value
+	}
+	return strings.Join(values, " ")
+}
+
+// Parses and removes flags from tokens, returning the remaining fields
+func parseFlags(tokens []*Token, m *discordgo.MessageCreate, target *CommandDef, parsed *ParsedCommand) ([]*Token, error) {
+	fields := make([]*Token, 0, len(tokens))
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.Quoted || !strings.HasPrefix(token.Value, "--") || len(token.Value) < 3 {
+			fields = append(fields, token)
+			continue
+		}
+
+		name := token.Value[2:]
+		value := ""
+		hasValue := false
+		if index := strings.Index(name, "="); index != -1 {
+			name, value = name[:index], name[index+1:]
+			hasValue = true
+		}
+
+		var def *ArgumentDef
+		for _, v := range target.Flags {
+			if strings.EqualFold(v.Name, name) {
+				def = v
+				break
+			}
+		}
+		if def == nil {
+			names := make([]string, len(target.Flags))
+			for k, v := range target.Flags {
+				names[k] = "--" + v.Name
 			}
+			return nil, WithSuggestion(NewLocaleError("parse.unknown_flag", name), "--"+name, names)
+		}
 
-			if val == nil {
-				err = ErrDiscordUserNotFound
+		if !hasValue {
+			if i+1 >= len(tokens) {
+				return nil, NewLocaleError("parse.flag_needs_value", def.Name)
 			}
+			i++
+			value = tokens[i].Value
 		}
 
+		parsedFlag, err := ParseArgument(def, value, m)
 		if err != nil {
 			return nil, err
 		}
 
-		parsedArgs[k] = &ParsedArgument{
-			Raw:    field,
-			Parsed: val,
+		if parsed.Flags == nil {
+			parsed.Flags = make(map[string]*ParsedArgument)
 		}
+		parsed.Flags[def.Name] = parsedFlag
 	}
 
-	return &ParsedCommand{
-		Name: target.Name,
-		Cmd:  target,
-		Args: parsedArgs,
-	}, nil
+	return fields, nil
 }
 
-func FindDiscordUser(str string, m *discordgo.MessageCreate) (*discordgo.User, error) {
-	channel, err := dgo.State.Channel(m.ChannelID)
+// Parses a single argument
+func ParseArgument(def *ArgumentDef, field string, m *discordgo.MessageCreate) (*ParsedArgument, error) {
+	var err error
+	var val interface{}
+
+	switch def.Type {
+	case ArgumentTypeNumber:
+		val, err = strconv.ParseFloat(field, 64)
+	case ArgumentTypeString:
+		val = field
+	case ArgumentTypeUser:
+		if strings.Index(field, "<@") == 0 {
+			// Direct mention, anything too short to be one is left as not found
+			if len(field) >= 4 && strings.HasSuffix(field, ">") {
+				id := strings.TrimPrefix(field[2:len(field)-1], "!")
+
+				for _, v := range m.Mentions {
+					if id == v.ID {
+						val = v
+						break
+					}
+				}
+			}
+		} else {
+			// Search for username
+			val, err = FindDiscordUser(field, m)
+		}
+
+		if val == nil {
+			err = ErrDiscordUserNotFound
+		}
+	case ArgumentTypeEnum:
+		var choice *ArgumentChoice
+		choice, err = FindChoice(def.Choices, def.Name, field)
+		if choice != nil {
+			val = choice.Value
+		}
+	case ArgumentTypeItem:
+		val, err = FindItemType(field)
+	case ArgumentTypeInventorySlot:
+		val, err = parseInventorySlot(field, m)
+	case ArgumentTypeRole:
+		val, err = parseRole(field)
+	case ArgumentTypeChannel:
+		val, err = parseChannel(field)
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
-	guild, err := dgo.State.Guild(channel.GuildID)
+	return &ParsedArgument{
+		Raw:    field,
+		Parsed: val,
+	}, nil
+}
+
+// Parses an inventory slot and checks that it exists in the authors inventory
+func parseInventorySlot(field string, m *discordgo.MessageCreate) (int, error) {
+	slot, err := strconv.Atoi(field)
 	if err != nil {
-		return nil, err
+		return 0, NewLocaleError("parse.not_inventory_slot", field)
 	}
 
-	dgo.State.RLock()
-	defer dgo.State.RUnlock()
-	for _, v := range guild.Members {
-		if strings.EqualFold(str, v.User.Username) {
-			return v.User, nil
-		}
+	player := Players.GetCreatePlayer(Guilds.Economy(m.GuildID), m.Author.ID, m.Author.Username)
+	player.RLock()
+	numItems := len(player.Inventory)
+	player.RUnlock()
+
+	if numItems < 1 {
+		return 0, NewLocaleError("parse.no_items")
+	}
+
+	if slot < 0 || slot >= numItems {
+		return 0, NewLocaleError("parse.inventory_slot_range", slot, numItems-1)
+	}
+
+	return slot, nil
+}
+
+// Parses a role mention or id into the role id
+func parseRole(field string) (string, error) {
+	id := strings.TrimSuffix(strings.TrimPrefix(field, "<@&"), ">")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", NewLocaleError("parse.not_role", field)
 	}
+	return id, nil
+}
 
-	return nil, ErrDiscordUserNotFound
+func parseChannel(field string) (string, error) {
+	id := strings.TrimSuffix(strings.TrimPrefix(field, "<#"), ">")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", NewLocaleError("parse.not_channel", field)
+	}
+	return id, nil
+}
+
+func FindDiscordUser(str string, m *discordgo.MessageCreate) (*discordgo.User, error) {
+	return transport.FindMember(m.ChannelID, str)
 }
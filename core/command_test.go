@@ -0,0 +1,155 @@
+package core
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want []string
+		err  error
+	}{
+		{raw: "buy sword 2", want: []string{"buy", "sword", "2"}},
+		{raw: "  spaced \t out  ", want: []string{"spaced", "out"}},
+		{raw: `give "Dragon Scale" 1`, want: []string{"give", "Dragon Scale", "1"}},
+		{raw: `give 'Dragon Scale' 1`, want: []string{"give", "Dragon Scale", "1"}},
+		{raw: "give Dragon's Tooth", want: []string{"give", "Dragon's", "Tooth"}},
+		{raw: "rename O'Neil", want: []string{"rename", "O'Neil"}},
+		{raw: `give "Dragon's Tooth"`, want: []string{"give", "Dragon's Tooth"}},
+		{raw: `say "she said \"hi\""`, want: []string{"say", `she said "hi"`}},
+		{raw: `say a\ b \'c`, want: []string{"say", "a b", "'c"}},
+		{raw: `say ab"c d"e`, want: []string{"say", "abc de"}},
+		{raw: `say ""`, want: []string{"say", ""}},
+		{raw: `say "hello`, err: ErrUnterminatedQuote},
+		{raw: `say 'hello`, err: ErrUnterminatedQuote},
+	}
+
+	for _, c := range cases {
+		tokens, err := Tokenize(c.raw)
+		if err != c.err {
+			t.Errorf("%s: got error %v, want %v", c.raw, err, c.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		values := make([]string, len(tokens))
+		for k, v := range tokens {
+			values[k] = v.Value
+		}
+		if !reflect.DeepEqual(values, c.want) {
+			t.Errorf("%s: got %q, want %q", c.raw, values, c.want)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: "channel", Author: &discordgo.User{ID: "2"}}}
+	cmd := &CommandDef{
+		Name:         "say",
+		RequiredArgs: 1,
+		Arguments: []*ArgumentDef{
+			&ArgumentDef{Name: "times", Type: ArgumentTypeNumber},
+			&ArgumentDef{Name: "text", Type: ArgumentTypeString, Greedy: true},
+		},
+		Flags: []*ArgumentDef{
+			&ArgumentDef{Name: "page", Type: ArgumentTypeNumber},
+		},
+	}
+
+	cases := []struct {
+		raw   string
+		text  string // Empty if the text argument isn't given
+		page  int    // 0 if the flag isn't given
+		error bool
+	}{
+		{raw: "2", text: ""},
+		{raw: "2 hello", text: "hello"},
+		{raw: "2 hello   there,  world", text: "hello   there,  world"},
+		{raw: "2 Dragon's Tooth", text: "Dragon's Tooth"},
+		{raw: `2 "hello   there"`, text: "hello   there"},
+		{raw: `2 say "hi" to\ them`, text: `say "hi" to\ them`},
+		{raw: "--page 3 2 hello  there", text: "hello  there", page: 3},
+		{raw: "2 hello there --page=3", text: "hello there", page: 3},
+		{raw: "2 hello --page 3 there", text: "hello there", page: 3},
+		{raw: `2 "--page" 3`, text: `"--page" 3`},
+		{raw: "2 hello --page", error: true},
+		{raw: "2 hello --size 3", error: true},
+		{raw: "--page 3", error: true},
+		{raw: "two hello", error: true},
+	}
+
+	for _, c := range cases {
+		tokens, err := Tokenize(c.raw)
+		if err != nil {
+			t.Errorf("%s: Tokenize: %v", c.raw, err)
+			continue
+		}
+
+		parsed, err := ParseCommand(tokens, m, cmd)
+		if c.error {
+			if err == nil {
+				t.Errorf("%s: parsed without an error", c.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.raw, err)
+			continue
+		}
+
+		if parsed.Arg(0).Int() != 2 {
+			t.Errorf("%s: times is %d, want 2", c.raw, parsed.Arg(0).Int())
+		}
+
+		text := ""
+		if arg := parsed.Arg(1); arg != nil {
+			text = arg.Str()
+		}
+		if text != c.text {
+			t.Errorf("%s: text is %q, want %q", c.raw, text, c.text)
+		}
+
+		page := 0
+		if flag := parsed.Flag("page"); flag != nil {
+			page = flag.Int()
+		}
+		if page != c.page {
+			t.Errorf("%s: page is %d, want %d", c.raw, page, c.page)
+		}
+	}
+}
+
+func TestParseUserArgument(t *testing.T) {
+	user := &discordgo.User{ID: "2", Username: "tester"}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ChannelID: "channel",
+			Author:    user,
+			Mentions:  []*discordgo.User{user},
+		},
+	}
+	def := &ArgumentDef{Name: "user", Type: ArgumentTypeUser}
+
+	for _, field := range []string{"<@2>", "<@!2>"} {
+		parsed, err := ParseArgument(def, field, m)
+		if err != nil {
+			t.Errorf("%s: %v", field, err)
+			continue
+		}
+		if parsed.DiscordUser() != user {
+			t.Errorf("%s: parsed %v, want the mentioned user", field, parsed.DiscordUser())
+		}
+	}
+
+	for _, field := range []string{"<@", "<@>", "<@!>", "<@2", "<@3>"} {
+		_, err := ParseArgument(def, field, m)
+		if err != ErrDiscordUserNotFound {
+			t.Errorf("%s: got error %v, want ErrDiscordUserNotFound", field, err)
+		}
+	}
+}
@@ -1,20 +1,84 @@
 package core
 
-import ()
+import (
+	"github.com/bwmarrin/discordgo"
+)
 
-var CommonCommands = []*CommandDef{}
+// Replies with help for cmd, or all commands grouped by category if cmd is empty
+// Commands the author doesn't have permission to use are hidden
+func SendHelp(ctx *CommandContext, cmd string) error {
+	tokens, err := Tokenize(cmd)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) < 1 {
+		card, rows := HelpPages(ctx.Message)
+		return ctx.ReplyPages(card, rows, HelpPageSize)
+	}
+
+	level := GetPermissionLevel(ctx.Message)
+	def, rest := ResolveCommand(tokens)
+	if def == nil || len(rest) > 0 || def.RequiredPermission() > level {
+		var err error = NewLocaleError("help.unknown_command", cmd)
+		if def == nil {
+			err = WithSuggestion(err, tokens[0].Value, CommandNames(level))
+		}
+		return err
+	}
+
+	return ctx.ReplyEmbed(def.HelpCard(level, ctx.Language))
+}
 
-func SendHelp(channel string, cmd string) {
-	out := "**BattleBot help**\n\n"
+// Lines per page in the command listing
+const HelpPageSize = 20
 
+// Returns the header and the lines of the command listing, grouped by category
+// Commands the author of m doesn't have permission to use are hidden
+func HelpPages(m *discordgo.MessageCreate) (*Card, []string) {
+	level := GetPermissionLevel(m)
+	code := LanguageFor(m.Author.ID, m.GuildID)
+
+	card := &Card{
+		Title:       T(code, "help.title"),
+		Description: T(code, "help.description") + "\n",
+		Color:       ColorStats,
+		Footer:      VERSION,
+	}
+
+	categories := make([]string, 0)
+	listings := make(map[string][]string)
 	for _, cmd := range Commands {
-		if cmd.HideFromHelp {
+		if cmd.Permission > level {
 			continue
 		}
-		out += " - " + cmd.String() + "\n"
+
+		category := cmd.Category
+		if category == "" {
+			category = "Other"
+		}
+
+		if _, ok := listings[category]; !ok {
+			categories = append(categories, category)
+		}
+		listings[category] = append(listings[category], helpListing(cmd, level, code, "")...)
 	}
 
-	out += "\n" + VERSION
+	rows := make([]string, 0)
+	for _, category := range categories {
+		rows = append(rows, "**"+localName(code, "category", category)+"**")
+		rows = append(rows, listings[category]...)
+	}
+	return card, rows
+}
 
-	go SendMessage(channel, out)
+// Returns the help lines for cmd and its subcommands, indented below it
+func helpListing(cmd *CommandDef, level PermissionLevel, code, indent string) []string {
+	out := []string{indent + " - `" + cmd.Usage() + "` " + cmd.LocalDescription(code)}
+	for _, sub := range cmd.Subcommands {
+		if sub.Permission <= level {
+			out = append(out, helpListing(sub, level, code, indent+"   ")...)
+		}
+	}
+	return out
 }
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"time"
+)
+
+// How long a command can run before its context is cancelled
+const CommandTimeout = time.Second * 30
+
+// Passed to RunFuncs, has the parsed arguments and helpers for replying
+type CommandContext struct {
+	context.Context
+	*ParsedCommand
+
+	Message   *discordgo.MessageCreate
+	Author    *discordgo.User
+	ChannelID string
+	GuildID   string
+
+	// Language code replies should be in
+	Language string
+
+	player *Player
+}
+
+func NewCommandContext(ctx context.Context, parsed *ParsedCommand, m *discordgo.MessageCreate) *CommandContext {
+	return &CommandContext{
+		Context:       ctx,
+		ParsedCommand: parsed,
+		Message:       m,
+		Author:        m.Author,
+		ChannelID:     m.ChannelID,
+		GuildID:       m.GuildID,
+		Language:      LanguageFor(m.Author.ID, m.GuildID),
+	}
+}
+
+// Returns the player of the author in the economy of this guild, creating it if it doesn't exist
+func (c *CommandContext) Player() *Player {
+	if c.player == nil {
+		c.player = Players.GetCreatePlayer(c.Economy(), c.Author.ID, c.Author.Username)
+	}
+	return c.player
+}
+
+// Returns the economy players use here, see GuildManager.Economy
+func (c *CommandContext) Economy() string {
+	return Guilds.Economy(c.GuildID)
+}
+
+// Returns the message with id in the language of the context, see T
+func (c *CommandContext) T(id string, args ...interface{}) string {
+	return T(c.Language, id, args...)
+}
+
+// Returns the plural form for n of the message with id in the language of the context, see TN
+func (c *CommandContext) TN(id string, n int, args ...interface{}) string {
+	return TN(c.Language, id, n, args...)
+}
+
+// Sends msg to the channel the command was used in
+func (c *CommandContext) Reply(msg string) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+
+	if transport == nil {
+		return ErrNoTransport
+	}
+
+	_, err := transport.SendMessage(c.ChannelID, msg)
+	return err
+}
+
+func (c *CommandContext) Replyf(format string, args ...interface{}) error {
+	return c.Reply(fmt.Sprintf(format, args...))
+}
+
+// Sends card to the channel the command was used in, as an embed or text depending on the transport
+func (c *CommandContext) ReplyEmbed(card *Card) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return sendCard(c.ChannelID, card)
+}
+
+// Sends the page of rows the command asked for, see Paginator
+// card is the title, description and color of every page
+func (c *CommandContext) ReplyPages(card *Card, rows []string, perPage int) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+
+	p := NewPaginator(card, rows, perPage)
+	p.Owner = c.Author.ID
+	p.Language = c.Language
+	return p.Send(c.ChannelID, c.Page())
+}
+
+// Sends a message with embeds or components to the channel the command was used in
+func (c *CommandContext) ReplyComplex(msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	if transport == nil {
+		return nil, ErrNoTransport
+	}
+	return transport.SendComplex(c.ChannelID, msg)
+}
+
+// Sends msg to the author in a direct message
+func (c *CommandContext) DM(msg string) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+
+	if transport == nil {
+		return ErrNoTransport
+	}
+	return transport.SendDM(c.Author.ID, msg)
+}
+
+// Returned from RunInvocation when a RunFunc returns an error
+type CommandError struct {
+	Command string
+	Err     error
+}
+
+func (c *CommandError) Error() string {
+	return c.Err.Error()
+}
+
+func (c *CommandError) Unwrap() error {
+	return c.Err
+}
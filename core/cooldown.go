@@ -0,0 +1,147 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	Cooldowns = &CooldownManager{
+		cooldowns: make(map[string]map[string]time.Time),
+		recent:    make(map[string][]time.Time),
+	}
+)
+
+// Returned when a command is used while on cooldown or when the user is rate limited
+type CooldownError struct {
+	Command   string // Empty if rate limited
+	Remaining time.Duration
+}
+
+func (c *CooldownError) Error() string {
+	return c.Localize(FallbackLanguage)
+}
+
+func (c *CooldownError) Localize(code string) string {
+	seconds := int((c.Remaining + time.Second - 1) / time.Second)
+	if c.Command == "" {
+		return TN(code, "cooldown.ratelimited", seconds, seconds)
+	}
+	return TN(code, "cooldown.command", seconds, c.Command, seconds)
+}
+
+// Keeps track of per user command cooldowns and the global per user rate limit
+type CooldownManager struct {
+	sync.Mutex
+
+	// Max commands per user per minute, 0 for no limit
+	RateLimit int
+
+	cooldowns map[string]map[string]time.Time // user -> command -> when the cooldown expires
+	recent    map[string][]time.Time          // user -> times commands were used in the last minute
+
+	lastPrune time.Time
+}
+
+// How often expired cooldowns and rate limit entries of all users are removed
+const cooldownPruneInterval = time.Minute
+
+// Checks if user can use cmd, and if so records the usage
+// Call Undo if the command then fails, so it doesn't stay on cooldown
+func (cm *CooldownManager) Use(userID string, cmd *CommandDef) error {
+	cm.Lock()
+	defer cm.Unlock()
+
+	now := time.Now()
+	name := cmd.FullName()
+
+	if now.Sub(cm.lastPrune) >= cooldownPruneInterval {
+		cm.prune(now)
+	}
+
+	if expires, ok := cm.cooldowns[userID][name]; ok && expires.After(now) {
+		return &CooldownError{Command: name, Remaining: expires.Sub(now)}
+	}
+
+	if cm.RateLimit > 0 {
+		recent := cm.recent[userID]
+		for len(recent) > 0 && now.Sub(recent[0]) >= time.Minute {
+			recent = recent[1:]
+		}
+
+		if len(recent) >= cm.RateLimit {
+			cm.recent[userID] = recent
+			return &CooldownError{Remaining: time.Minute - now.Sub(recent[0])}
+		}
+
+		cm.recent[userID] = append(recent, now)
+	}
+
+	if cmd.Cooldown > 0 {
+		userCooldowns, ok := cm.cooldowns[userID]
+		if !ok {
+			userCooldowns = make(map[string]time.Time)
+			cm.cooldowns[userID] = userCooldowns
+		}
+		userCooldowns[name] = now.Add(cmd.Cooldown)
+	}
+
+	return nil
+}
+
+// Removes the cooldown Use started for cmd, for commands that failed
+func (cm *CooldownManager) Undo(userID string, cmd *CommandDef) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	if userCooldowns, ok := cm.cooldowns[userID]; ok {
+		delete(userCooldowns, cmd.FullName())
+		if len(userCooldowns) < 1 {
+			delete(cm.cooldowns, userID)
+		}
+	}
+}
+
+// Removes expired cooldowns and rate limit entries older than a minute, cm has to be locked
+func (cm *CooldownManager) prune(now time.Time) {
+	cm.lastPrune = now
+
+	for userID, userCooldowns := range cm.cooldowns {
+		for name, expires := range userCooldowns {
+			if !expires.After(now) {
+				delete(userCooldowns, name)
+			}
+		}
+		if len(userCooldowns) < 1 {
+			delete(cm.cooldowns, userID)
+		}
+	}
+
+	for userID, recent := range cm.recent {
+		if len(recent) < 1 || now.Sub(recent[len(recent)-1]) >= time.Minute {
+			delete(cm.recent, userID)
+		}
+	}
+}
+
+// Returns the active cooldowns for user by command name
+func (cm *CooldownManager) Remaining(userID string) map[string]time.Duration {
+	cm.Lock()
+	defer cm.Unlock()
+
+	now := time.Now()
+	out := make(map[string]time.Duration)
+	for cmd, expires := range cm.cooldowns[userID] {
+		if expires.After(now) {
+			out[cmd] = expires.Sub(now)
+		} else {
+			delete(cm.cooldowns[userID], cmd)
+		}
+	}
+
+	if len(cm.cooldowns[userID]) < 1 {
+		delete(cm.cooldowns, userID)
+	}
+
+	return out
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestCooldowns() *CooldownManager {
+	return &CooldownManager{
+		cooldowns: make(map[string]map[string]time.Time),
+		recent:    make(map[string][]time.Time),
+	}
+}
+
+func TestCooldownUndo(t *testing.T) {
+	cm := newTestCooldowns()
+	cmd := &CommandDef{Name: "slow", Cooldown: time.Hour}
+
+	if err := cm.Use("user", cmd); err != nil {
+		t.Fatal("first use:", err)
+	}
+	if err := cm.Use("user", cmd); err == nil {
+		t.Fatal("second use wasn't on cooldown")
+	}
+
+	cm.Undo("user", cmd)
+	if err := cm.Use("user", cmd); err != nil {
+		t.Fatal("use after undo:", err)
+	}
+}
+
+func TestCooldownPrune(t *testing.T) {
+	cm := newTestCooldowns()
+	cm.RateLimit = 10
+	cmd := &CommandDef{Name: "quick", Cooldown: time.Millisecond}
+
+	for _, user := range []string{"a", "b", "c"} {
+		if err := cm.Use(user, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cm.prune(time.Now().Add(time.Minute))
+	if len(cm.cooldowns) != 0 || len(cm.recent) != 0 {
+		t.Errorf("%d users with cooldowns and %d rate limited users left after pruning, want none", len(cm.cooldowns), len(cm.recent))
+	}
+}
+
+// Fails while testCooldownFail is true
+var testCooldownCommand = &CommandDef{
+	Name:     "testcooldown",
+	Cooldown: time.Hour,
+	RunFunc: func(ctx *CommandContext) error {
+		if testCooldownFail {
+			return errors.New("failed")
+		}
+		return nil
+	},
+}
+
+var testCooldownFail bool
+
+func init() {
+	RegisterCommands(testCooldownCommand)
+}
+
+func TestCooldownMiddlewareFailedCommand(t *testing.T) {
+	cmd := testCooldownCommand
+	testCooldownFail = true
+
+	_, m := newTestTransport(t, "<@1> testcooldown")
+	defer Cooldowns.Undo(m.Author.ID, cmd)
+
+	if err := HandleCommand(m.Content, m); err == nil {
+		t.Fatal("the failing command didn't return an error")
+	}
+
+	testCooldownFail = false
+	if err := HandleCommand(m.Content, m); err != nil {
+		t.Fatal("failed command was put on cooldown:", err)
+	}
+	if _, ok := Cooldowns.Use(m.Author.ID, cmd).(*CooldownError); !ok {
+		t.Fatal("successful command wasn't put on cooldown")
+	}
+}
@@ -0,0 +1,455 @@
+package core
+
+import (
+	"encoding/json"
+	"github.com/bwmarrin/discordgo"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	MaxPrefixLength = 10
+)
+
+var (
+	// Where guild settings are loaded from and saved to
+	GuildsFile = "guilds.json"
+
+	Guilds = &GuildManager{Guilds: make(map[string]*GuildSettings)}
+)
+
+type GuildManager struct {
+	sync.RWMutex
+	Guilds map[string]*GuildSettings
+}
+
+// Per guild settings, changed by guild admins
+type GuildSettings struct {
+	sync.RWMutex
+	Id string
+
+	// Text prefix commands can be invoked with in addition to mentioning the bot, empty for mentions only
+	Prefix string
+
+	// Members with these roles get admin or moderator permissions
+	AdminRoles     []string
+	ModeratorRoles []string
+
+	// Commands and categories that can't be used anywhere in this guild
+	CommandFilter
+
+	// Channels commands can be used in, empty for all channels
+	AllowedChannels []string
+
+	// Settings for single channels, keyed by channel id
+	Channels map[string]*ChannelSettings
+
+	// Language code for messages in this guild, empty for the bots default
+	Language string
+
+	// Players get separate money, items and leaderboards in this guild instead of using their global ones
+	LocalEconomy bool `json:",omitempty"`
+}
+
+// Per channel settings, on top of the guilds
+type ChannelSettings struct {
+	// Commands and categories that can't be used in this channel
+	CommandFilter
+}
+
+// Commands and categories that are turned off in a guild or channel
+type CommandFilter struct {
+	// Full names of commands, disabling a command also disables its subcommands
+	DisabledCommands []string
+
+	// Command categories, e.g "Battle"
+	DisabledCategories []string
+}
+
+// Returns true if cmd, any of its parents or its category are disabled
+func (f *CommandFilter) Disables(cmd *CommandDef) bool {
+	if cmd.Category != "" && stringInSlice(cmd.Category, f.DisabledCategories) {
+		return true
+	}
+
+	for c := cmd; c != nil; c = c.Parent() {
+		if stringInSlice(c.FullName(), f.DisabledCommands) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *CommandFilter) Empty() bool {
+	return len(f.DisabledCommands) < 1 && len(f.DisabledCategories) < 1
+}
+
+// Returns the filter for channel, or the guild wide one if channel is empty
+// s has to be locked, the channel settings are created if create is true
+func (s *GuildSettings) filter(channel string, create bool) *CommandFilter {
+	if channel == "" {
+		return &s.CommandFilter
+	}
+
+	settings, ok := s.Channels[channel]
+	if !ok {
+		if !create {
+			return nil
+		}
+
+		if s.Channels == nil {
+			s.Channels = make(map[string]*ChannelSettings)
+		}
+		settings = &ChannelSettings{}
+		s.Channels[channel] = settings
+	}
+	return &settings.CommandFilter
+}
+
+// Removes the settings for channel if there's nothing left in them, s has to be locked
+func (s *GuildSettings) cleanChannel(channel string) {
+	if settings, ok := s.Channels[channel]; ok && settings.Empty() {
+		delete(s.Channels, channel)
+	}
+}
+
+// Disables the command with full name in channel, or the whole guild if channel is empty
+// Returns false if it already was
+func (s *GuildSettings) DisableCommand(channel, name string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return addString(&s.filter(channel, true).DisabledCommands, name)
+}
+
+// Enables the command with full name again in channel, or the whole guild if channel is empty
+// Returns false if it wasn't disabled
+func (s *GuildSettings) EnableCommand(channel, name string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	filter := s.filter(channel, false)
+	if filter == nil || !removeString(&filter.DisabledCommands, name) {
+		return false
+	}
+	s.cleanChannel(channel)
+	return true
+}
+
+// Disables all commands in category in channel, or the whole guild if channel is empty
+// Returns false if it already was
+func (s *GuildSettings) DisableCategory(channel, category string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return addString(&s.filter(channel, true).DisabledCategories, category)
+}
+
+// Enables category again in channel, or the whole guild if channel is empty
+// Returns false if it wasn't disabled
+func (s *GuildSettings) EnableCategory(channel, category string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	filter := s.filter(channel, false)
+	if filter == nil || !removeString(&filter.DisabledCategories, category) {
+		return false
+	}
+	s.cleanChannel(channel)
+	return true
+}
+
+// Allows commands in channel, once a channel is allowed commands can only be used in allowed channels
+// Returns false if it already was
+func (s *GuildSettings) AllowChannel(channel string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return addString(&s.AllowedChannels, channel)
+}
+
+// Removes channel from the allowed channels, commands can be used everywhere again once none are left
+// Returns false if it wasn't allowed
+func (s *GuildSettings) DisallowChannel(channel string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return removeString(&s.AllowedChannels, channel)
+}
+
+// Returns the role list for level, s has to be locked
+func (s *GuildSettings) roles(level PermissionLevel) *[]string {
+	switch level {
+	case PermissionAdmin:
+		return &s.AdminRoles
+	case PermissionModerator:
+		return &s.ModeratorRoles
+	}
+	return nil
+}
+
+// Gives members with roleID the permission level, returns false if it already had it
+func (s *GuildSettings) AddRole(level PermissionLevel, roleID string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	roles := s.roles(level)
+	if roles == nil {
+		return false
+	}
+	return addString(roles, roleID)
+}
+
+// Removes the permission level from roleID, returns false if it did not have it
+func (s *GuildSettings) RemoveRole(level PermissionLevel, roleID string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	roles := s.roles(level)
+	if roles == nil {
+		return false
+	}
+	return removeString(roles, roleID)
+}
+
+// Appends v to list, returns false if it was already in it
+func addString(list *[]string, v string) bool {
+	if stringInSlice(v, *list) {
+		return false
+	}
+	*list = append(*list, v)
+	return true
+}
+
+// Removes v from list, returns false if it wasn't in it
+func removeString(list *[]string, v string) bool {
+	for k, s := range *list {
+		if s == v {
+			*list = append((*list)[:k], (*list)[k+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (gm *GuildManager) Load() error {
+	file, err := ioutil.ReadFile(GuildsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var decoded map[string]*GuildSettings
+	err = json.Unmarshal(file, &decoded)
+	if err != nil {
+		return err
+	}
+
+	if decoded == nil {
+		// The file was just "null"
+		decoded = make(map[string]*GuildSettings)
+	}
+
+	gm.Lock()
+	gm.Guilds = decoded
+	gm.Unlock()
+	return nil
+}
+
+func (gm *GuildManager) Save() error {
+	gm.RLock()
+	encoded := make(map[string]json.RawMessage, len(gm.Guilds))
+	for id, settings := range gm.Guilds {
+		// Commands change the settings while holding their own lock
+		settings.RLock()
+		out, err := json.Marshal(settings)
+		settings.RUnlock()
+		if err != nil {
+			gm.RUnlock()
+			return err
+		}
+		encoded[id] = out
+	}
+	gm.RUnlock()
+
+	out, err := json.Marshal(encoded)
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(GuildsFile, out, 0644)
+}
+
+// Returns the settings for guild id, creating them if they don't exist
+func (gm *GuildManager) GetCreate(id string) *GuildSettings {
+	gm.Lock()
+	defer gm.Unlock()
+
+	if settings, ok := gm.Guilds[id]; ok {
+		return settings
+	}
+
+	settings := &GuildSettings{
+		Id: id,
+	}
+	gm.Guilds[id] = settings
+	return settings
+}
+
+// Returns the settings for guild id, nil if none
+func (gm *GuildManager) Get(id string) *GuildSettings {
+	gm.RLock()
+	defer gm.RUnlock()
+	return gm.Guilds[id]
+}
+
+// Returns the prefix for guild id, empty if none is set
+func (gm *GuildManager) Prefix(id string) string {
+	settings := gm.Get(id)
+	if settings == nil {
+		return ""
+	}
+
+	settings.RLock()
+	defer settings.RUnlock()
+	return settings.Prefix
+}
+
+// Returns the language set for guild id, empty if none is set
+func (gm *GuildManager) Language(id string) string {
+	settings := gm.Get(id)
+	if settings == nil {
+		return ""
+	}
+
+	settings.RLock()
+	defer settings.RUnlock()
+	return settings.Language
+}
+
+// Returns the economy players in guild id use: id if it has a local economy, empty for the global one
+func (gm *GuildManager) Economy(id string) string {
+	settings := gm.Get(id)
+	if settings == nil {
+		return ""
+	}
+
+	settings.RLock()
+	defer settings.RUnlock()
+	if settings.LocalEconomy {
+		return id
+	}
+	return ""
+}
+
+// Returns the highest permission level any of roles gives in guild id
+func (gm *GuildManager) RolesPermissionLevel(id string, roles []string) PermissionLevel {
+	settings := gm.Get(id)
+	if settings == nil {
+		return PermissionUser
+	}
+
+	settings.RLock()
+	defer settings.RUnlock()
+
+	level := PermissionUser
+	for _, role := range roles {
+		for _, v := range settings.AdminRoles {
+			if v == role {
+				return PermissionAdmin
+			}
+		}
+
+		for _, v := range settings.ModeratorRoles {
+			if v == role {
+				level = PermissionModerator
+			}
+		}
+	}
+	return level
+}
+
+// Returns true if cmd, any of its parents or its category are disabled in guild id or channel
+// Only the guild wide settings are checked if channel is empty
+func (gm *GuildManager) CommandDisabled(id, channel string, cmd *CommandDef) bool {
+	settings := gm.Get(id)
+	if settings == nil {
+		return false
+	}
+
+	if !cmd.CanDisable() {
+		return false
+	}
+
+	settings.RLock()
+	defer settings.RUnlock()
+
+	if settings.Disables(cmd) {
+		return true
+	}
+
+	if filter := settings.filter(channel, false); filter != nil && filter.Disables(cmd) {
+		return true
+	}
+	return false
+}
+
+// Returns the channels of guild id that commands are restricted to, empty if they can be used everywhere
+func (gm *GuildManager) AllowedChannels(id string) []string {
+	settings := gm.Get(id)
+	if settings == nil {
+		return nil
+	}
+
+	settings.RLock()
+	defer settings.RUnlock()
+	return append([]string(nil), settings.AllowedChannels...)
+}
+
+// Returns true if commands can be used in channel in guild id
+func (gm *GuildManager) ChannelAllowed(id, channel string) bool {
+	allowed := gm.AllowedChannels(id)
+	return len(allowed) < 1 || stringInSlice(channel, allowed)
+}
+
+// Strips the bot mention or the guilds prefix from the start of content
+// Returns false if content didn't start with either
+func StripCommandPrefix(content, guildID string) (string, bool) {
+	if bot := transport.BotUser(); bot != nil {
+		for _, mention := range []string{"<@" + bot.ID + ">", "<@!" + bot.ID + ">"} {
+			if strings.HasPrefix(content, mention) {
+				return strings.TrimSpace(content[len(mention):]), true
+			}
+		}
+	}
+
+	prefix := Guilds.Prefix(guildID)
+	if prefix != "" && strings.HasPrefix(content, prefix) {
+		return strings.TrimSpace(content[len(prefix):]), true
+	}
+
+	return content, false
+}
+
+// Returns true if the author of m has manage server or administrator permissions in the channel
+func IsGuildAdmin(m *discordgo.MessageCreate) bool {
+	perms, err := transport.UserPermissions(m.Author.ID, m.ChannelID)
+	if err != nil {
+		return false
+	}
+
+	return perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Runs the test in a temporary directory, GuildsFile is relative to it
+func inTempDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestGuildManagerLoadNull(t *testing.T) {
+	inTempDir(t)
+
+	err := ioutil.WriteFile(GuildsFile, []byte("null"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gm := &GuildManager{}
+	err = gm.Load()
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+
+	settings := gm.GetCreate("guild")
+	if settings == nil || gm.Get("guild") != settings {
+		t.Fatal("GetCreate didn't store the settings")
+	}
+}
+
+func TestGuildManagerSave(t *testing.T) {
+	inTempDir(t)
+
+	gm := &GuildManager{Guilds: make(map[string]*GuildSettings)}
+	gm.GetCreate("guild").Prefix = "!"
+
+	// Saving while the settings are changed, run with -race to catch unlocked reads
+	done := make(chan bool)
+	go func() {
+		settings := gm.Get("guild")
+		for i := 0; i < 100; i++ {
+			settings.Lock()
+			settings.AdminRoles = append(settings.AdminRoles, "role")
+			settings.Unlock()
+		}
+		close(done)
+	}()
+	for i := 0; i < 10; i++ {
+		err := gm.Save()
+		if err != nil {
+			t.Fatal("Save:", err)
+		}
+	}
+	<-done
+
+	err := gm.Save()
+	if err != nil {
+		t.Fatal("Save:", err)
+	}
+
+	loaded := &GuildManager{}
+	err = loaded.Load()
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+
+	if prefix := loaded.Prefix("guild"); prefix != "!" {
+		t.Errorf("loaded prefix %q, want %q", prefix, "!")
+	}
+	if n := len(loaded.Get("guild").AdminRoles); n != 100 {
+		t.Errorf("loaded %d admin roles, want 100", n)
+	}
+}
@@ -0,0 +1,533 @@
+package core
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Handles a press on a message component, args is the custom id split by ':' without the handler name
+// Returning an error responds with it to the user, the handler is responsible for updating the message
+type ComponentHandler func(user *discordgo.User, msg *discordgo.Message, args []string) error
+
+// Component handlers by the first part of the custom id
+var ComponentHandlers = map[string]ComponentHandler{
+	"battle": HandleBattleComponent,
+	"page":   HandlePageComponent,
+}
+
+// Commands component presses count as, by the first one or two parts of the custom id
+// Presses go through the middleware chain as that command, so buttons can't be used where or when the command can't
+// Presses not listed here count as a command named after their handler, which is only blocked by the checks for every command
+var ComponentCommands = map[string]string{
+	"battle:accept":  "accept",
+	"battle:decline": "decline",
+}
+
+var ErrUnknownComponent = NewLocaleError("error.unknown_component")
+
+// Runs a press on a message component through the middleware chain and then its handler
+// m is the press as a message from the user that pressed it, msg is the message the component is on
+func HandleComponent(m *discordgo.MessageCreate, msg *discordgo.Message, customID string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Recovered from panic ", r, "\n", customID, "\n", string(debug.Stack()))
+			err = ErrCommandPanic
+		}
+	}()
+
+	split := strings.Split(customID, ":")
+	handler, ok := ComponentHandlers[split[0]]
+	if !ok {
+		return ErrUnknownComponent
+	}
+
+	name, ok := "", false
+	if len(split) > 1 {
+		name, ok = ComponentCommands[split[0]+":"+split[1]]
+	}
+	if !ok {
+		name, ok = ComponentCommands[split[0]]
+	}
+
+	var cmd *CommandDef
+	if ok {
+		cmd = FindCommand(name)
+	}
+	if cmd == nil {
+		cmd = &CommandDef{Name: split[0]}
+	}
+
+	m.Content = customID
+	return RunInvocation(&Invocation{
+		Cmd:     cmd,
+		Message: m,
+		parse: func() (*ParsedCommand, error) {
+			return &ParsedCommand{Name: cmd.FullName(), Cmd: cmd}, nil
+		},
+		run: func(ctx *CommandContext) error {
+			return handler(m.Author, msg, split[1:])
+		},
+	})
+}
+
+const (
+	// Discord limits for application commands
+	maxCommandNameLength        = 32
+	maxCommandDescriptionLength = 100
+	maxOptionChoices            = 25
+)
+
+// Returns application (slash) commands generated from the Commands registry
+func ApplicationCommands() []*discordgo.ApplicationCommand {
+	out := make([]*discordgo.ApplicationCommand, 0, len(Commands))
+	for _, cmd := range Commands {
+		appCmd := &discordgo.ApplicationCommand{
+			Type:        discordgo.ChatApplicationCommand,
+			Name:        applicationCommandName(cmd.Name),
+			Description: applicationCommandDescription(cmd.Description, cmd.Name),
+			Options:     applicationCommandOptions(cmd, 0),
+
+			DefaultMemberPermissions: memberPermissions(cmd.RequiredPermission()),
+		}
+
+		out = append(out, appCmd)
+	}
+	return out
+}
+
+// Returns the discord permissions needed to see a command requiring level in the slash command picker, nil for everyone
+// Server admins can change this in the server settings, e.g for members of the moderator and admin roles, which discord doesn't know about
+// Subcommands that need a higher level than their top level command are still checked when they're run
+func memberPermissions(level PermissionLevel) *int64 {
+	var perms int64
+	switch level {
+	case PermissionUser:
+		return nil
+	case PermissionModerator:
+		perms = discordgo.PermissionManageMessages
+	case PermissionAdmin:
+		perms = discordgo.PermissionManageServer
+	default:
+		perms = discordgo.PermissionAdministrator
+	}
+	return &perms
+}
+
+// Slash commands with subcommands can't be invoked themselves, so commands that have both
+// a RunFunc and subcommands get an extra subcommand with this name that runs the command itself
+const defaultSubcommandName = "show"
+
+// Returns the options for cmd, depth is the number of parents it has
+func applicationCommandOptions(cmd *CommandDef, depth int) []*discordgo.ApplicationCommandOption {
+	if len(cmd.Subcommands) < 1 {
+		return applicationCommandArguments(cmd)
+	}
+
+	out := make([]*discordgo.ApplicationCommandOption, 0, len(cmd.Subcommands)+1)
+	if cmd.RunFunc != nil {
+		out = append(out, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        defaultSubcommandName,
+			Description: applicationCommandDescription(cmd.Description, cmd.Name),
+			Options:     applicationCommandArguments(cmd),
+		})
+	}
+
+	for _, sub := range cmd.Subcommands {
+		opt := &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        applicationCommandName(sub.Name),
+			Description: applicationCommandDescription(sub.Description, sub.Name),
+		}
+
+		if len(sub.Subcommands) > 0 {
+			// Discord only allows one level of subcommand groups
+			if depth > 0 {
+				log.Println("Subcommands of", sub.FullName(), "are nested too deep for slash commands, skipping")
+				continue
+			}
+			opt.Type = discordgo.ApplicationCommandOptionSubCommandGroup
+		}
+
+		opt.Options = applicationCommandOptions(sub, depth+1)
+		out = append(out, opt)
+	}
+	return out
+}
+
+// Returns the argument and flag options for cmd
+func applicationCommandArguments(cmd *CommandDef) []*discordgo.ApplicationCommandOption {
+	out := make([]*discordgo.ApplicationCommandOption, 0, len(cmd.Arguments)+len(cmd.Flags))
+	for k, arg := range cmd.Arguments {
+		out = append(out, applicationCommandOption(arg, k < cmd.RequiredArgs))
+	}
+
+	for _, flag := range cmd.Flags {
+		out = append(out, applicationCommandOption(flag, false))
+	}
+	return out
+}
+
+func applicationCommandOption(arg *ArgumentDef, required bool) *discordgo.ApplicationCommandOption {
+	opt := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        applicationCommandName(arg.Name),
+		Description: applicationCommandDescription(arg.Description, arg.Name),
+		Required:    required,
+	}
+
+	switch arg.Type {
+	case ArgumentTypeNumber:
+		opt.Type = discordgo.ApplicationCommandOptionNumber
+	case ArgumentTypeUser:
+		opt.Type = discordgo.ApplicationCommandOptionUser
+	case ArgumentTypeInventorySlot:
+		opt.Type = discordgo.ApplicationCommandOptionInteger
+	case ArgumentTypeRole:
+		opt.Type = discordgo.ApplicationCommandOptionRole
+	case ArgumentTypeChannel:
+		opt.Type = discordgo.ApplicationCommandOptionChannel
+	case ArgumentTypeEnum, ArgumentTypeItem:
+		// Discord rejects options with too many choices, those are suggested while typing instead
+		choices := optionChoices(arg, "")
+		if len(choices) > maxOptionChoices {
+			opt.Autocomplete = true
+		} else {
+			opt.Choices = choices
+		}
+	}
+
+	return opt
+}
+
+// Returns the choices of an enum or item argument whose name contains typed, ignoring case
+func optionChoices(arg *ArgumentDef, typed string) []*discordgo.ApplicationCommandOptionChoice {
+	typed = strings.ToLower(typed)
+
+	out := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	switch arg.Type {
+	case ArgumentTypeEnum:
+		for _, choice := range arg.Choices {
+			if strings.Contains(strings.ToLower(choice.Name), typed) {
+				out = append(out, &discordgo.ApplicationCommandOptionChoice{Name: choice.Name, Value: choice.Name})
+			}
+		}
+	case ArgumentTypeItem:
+		for _, item := range ItemTypes {
+			if strings.Contains(strings.ToLower(item.Name), typed) {
+				out = append(out, &discordgo.ApplicationCommandOptionChoice{Name: item.Name, Value: strconv.Itoa(item.Id)})
+			}
+		}
+	}
+	return out
+}
+
+// Names have to be lowercase and can only contain letters, numbers, - and _
+func applicationCommandName(name string) string {
+	out := make([]rune, 0, len(name))
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			out = append(out, r)
+		case unicode.IsSpace(r):
+			out = append(out, '_')
+		}
+	}
+
+	if len(out) > maxCommandNameLength {
+		out = out[:maxCommandNameLength]
+	}
+	return string(out)
+}
+
+// Descriptions are required and limited to 100 characters
+func applicationCommandDescription(desc, fallback string) string {
+	if desc == "" {
+		desc = fallback
+	}
+
+	runes := []rune(desc)
+	if len(runes) > maxCommandDescriptionLength {
+		desc = string(runes[:maxCommandDescriptionLength-3]) + "..."
+	}
+	return desc
+}
+
+func HandleInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		handleApplicationCommand(s, i)
+	case discordgo.InteractionMessageComponent:
+		handleMessageComponent(s, i)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		handleAutocomplete(s, i)
+	}
+}
+
+// Suggests choices for the option being typed, for options with too many choices to register (see applicationCommandOption)
+func handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+
+	def, options := resolveInteraction(data)
+	if def != nil {
+		for _, opt := range options {
+			if !opt.Focused {
+				continue
+			}
+
+			for _, args := range [][]*ArgumentDef{def.Arguments, def.Flags} {
+				for _, arg := range args {
+					if applicationCommandName(arg.Name) == opt.Name {
+						choices = optionChoices(arg, fmt.Sprint(opt.Value))
+					}
+				}
+			}
+		}
+	}
+
+	if len(choices) > maxOptionChoices {
+		choices = choices[:maxOptionChoices]
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Println("Error responding to autocomplete:", err)
+	}
+}
+
+func handleMessageComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+
+	m := interactionMessage(i)
+	err := HandleComponent(m, i.Message, data.CustomID)
+	if err != nil {
+		if err == ErrUnknownComponent {
+			log.Println("Unknown component custom id", data.CustomID)
+		}
+		respondInteraction(s, i, LocalizeError(LanguageFor(m.Author.ID, i.GuildID), err), true)
+		return
+	}
+
+	// The handler updates the message itself
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.Println("Error responding to interaction:", err)
+	}
+}
+
+func handleApplicationCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	m := interactionMessage(i)
+	code := LanguageFor(m.Author.ID, m.GuildID)
+
+	responded := false
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Recovered from panic ", r, "\n", data.Name, "\n", string(debug.Stack()))
+			respondInteractionError(s, i, T(code, "error.generic", LocalizeError(code, ErrCommandPanic)), responded)
+		}
+	}()
+
+	def, options := resolveInteraction(data)
+	if def == nil || def.RunFunc == nil {
+		respondInteraction(s, i, T(code, "error.generic", LocalizeError(code, ErrCommandNotFound)), true)
+		return
+	}
+
+	err := RunInvocation(&Invocation{
+		Cmd:     def,
+		Message: m,
+		parse: func() (*ParsedCommand, error) {
+			parsed, err := ParseInteraction(data, options, def, m)
+			if err != nil {
+				return nil, err
+			}
+
+			// Mention resolved users so RunFuncs see them like they would in a normal message
+			for _, arg := range parsed.Args {
+				if user := arg.DiscordUser(); user != nil {
+					m.Mentions = append(m.Mentions, user)
+				}
+			}
+			m.Content = parsed.String()
+			return parsed, nil
+		},
+		BeforeRun: func() {
+			// The commands reply to the channel themselves, so just acknowledge the interaction with what was run
+			respondInteraction(s, i, T(code, "interaction.used", m.Author.Username, m.Content), false)
+			responded = true
+		},
+	})
+
+	if err == nil {
+		return
+	}
+
+	msg := LocalizeError(code, err)
+	if !IsNoticeError(err) {
+		msg = T(code, "error.generic", msg)
+	}
+
+	respondInteractionError(s, i, msg, responded)
+}
+
+// Shows msg only to the user, as a followup if the interaction was already responded to
+func respondInteractionError(s *discordgo.Session, i *discordgo.InteractionCreate, msg string, responded bool) {
+	if !responded {
+		respondInteraction(s, i, msg, true)
+		return
+	}
+
+	_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: msg,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending interaction followup:", err)
+	}
+}
+
+// Walks the command tree using the subcommand options, returning the command and its options
+func resolveInteraction(data discordgo.ApplicationCommandInteractionData) (*CommandDef, []*discordgo.ApplicationCommandInteractionDataOption) {
+	var def *CommandDef
+	for _, v := range Commands {
+		if applicationCommandName(v.Name) == data.Name {
+			def = v
+			break
+		}
+	}
+
+	options := data.Options
+	for def != nil && len(options) == 1 {
+		opt := options[0]
+		if opt.Type != discordgo.ApplicationCommandOptionSubCommand && opt.Type != discordgo.ApplicationCommandOptionSubCommandGroup {
+			break
+		}
+
+		var sub *CommandDef
+		for _, v := range def.Subcommands {
+			if applicationCommandName(v.Name) == opt.Name {
+				sub = v
+				break
+			}
+		}
+
+		if sub == nil && opt.Name != defaultSubcommandName {
+			return nil, nil
+		}
+
+		if sub != nil {
+			def = sub
+		}
+		options = opt.Options
+	}
+
+	return def, options
+}
+
+// Parses the options of an application command into a ParsedCommand, options should be the ones for target (see resolveInteraction)
+func ParseInteraction(data discordgo.ApplicationCommandInteractionData, options []*discordgo.ApplicationCommandInteractionDataOption, target *CommandDef, m *discordgo.MessageCreate) (*ParsedCommand, error) {
+	parsed := &ParsedCommand{
+		Name: target.FullName(),
+		Cmd:  target,
+	}
+
+	if len(target.Arguments) > 0 {
+		parsed.Args = make([]*ParsedArgument, len(target.Arguments))
+	}
+
+	for _, opt := range options {
+		for _, flag := range target.Flags {
+			if applicationCommandName(flag.Name) != opt.Name {
+				continue
+			}
+
+			parsedFlag, err := ParseArgument(flag, fmt.Sprint(opt.Value), m)
+			if err != nil {
+				return nil, err
+			}
+
+			if parsed.Flags == nil {
+				parsed.Flags = make(map[string]*ParsedArgument)
+			}
+			parsed.Flags[flag.Name] = parsedFlag
+		}
+
+		for k, arg := range target.Arguments {
+			if applicationCommandName(arg.Name) != opt.Name {
+				continue
+			}
+
+			if arg.Type != ArgumentTypeUser {
+				// Everything else is parsed the same way as in text commands
+				parsedArg, err := ParseArgument(arg, fmt.Sprint(opt.Value), m)
+				if err != nil {
+					return nil, err
+				}
+				parsed.Args[k] = parsedArg
+				continue
+			}
+
+			if data.Resolved == nil || data.Resolved.Users[opt.StringValue()] == nil {
+				return nil, ErrDiscordUserNotFound
+			}
+
+			user := data.Resolved.Users[opt.StringValue()]
+			parsed.Args[k] = &ParsedArgument{
+				Raw:    "<@" + user.ID + ">",
+				Parsed: user,
+			}
+		}
+	}
+
+	return parsed, nil
+}
+
+// Creates a message from an interaction, so that it can be passed to RunFuncs
+func interactionMessage(i *discordgo.InteractionCreate) *discordgo.MessageCreate {
+	author := i.User
+	if i.Member != nil {
+		author = i.Member.User
+	}
+
+	return &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        i.ID,
+			ChannelID: i.ChannelID,
+			GuildID:   i.GuildID,
+			Author:    author,
+			Member:    i.Member,
+		},
+	}
+}
+
+func respondInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, msg string, ephemeral bool) {
+	data := &discordgo.InteractionResponseData{
+		Content: msg,
+	}
+	if ephemeral {
+		data.Flags = discordgo.MessageFlagsEphemeral
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		log.Println("Error responding to interaction:", err)
+	}
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"strconv"
+	"testing"
+)
+
+func init() {
+	ComponentHandlers["testpanic"] = func(user *discordgo.User, msg *discordgo.Message, args []string) error {
+		panic("test panic")
+	}
+}
+
+func TestApplicationCommandPermissions(t *testing.T) {
+	cases := []struct {
+		level PermissionLevel
+		want  int64
+	}{
+		{PermissionUser, 0},
+		{PermissionModerator, discordgo.PermissionManageMessages},
+		{PermissionAdmin, discordgo.PermissionManageServer},
+		{PermissionOwner, discordgo.PermissionAdministrator},
+	}
+
+	for _, c := range cases {
+		perms := memberPermissions(c.level)
+		if c.want == 0 {
+			if perms != nil {
+				t.Errorf("%s: got permissions %d, want none", c.level, *perms)
+			}
+			continue
+		}
+
+		if perms == nil || *perms != c.want {
+			t.Errorf("%s: got permissions %v, want %d", c.level, perms, c.want)
+		}
+	}
+}
+
+func TestApplicationCommandOptionChoices(t *testing.T) {
+	few := &ArgumentDef{Name: "few", Type: ArgumentTypeEnum}
+	many := &ArgumentDef{Name: "many", Type: ArgumentTypeEnum}
+	for i := 0; i < maxOptionChoices+5; i++ {
+		choice := &ArgumentChoice{Name: "choice" + strconv.Itoa(i), Value: i}
+		if i < 3 {
+			few.Choices = append(few.Choices, choice)
+		}
+		many.Choices = append(many.Choices, choice)
+	}
+
+	opt := applicationCommandOption(few, false)
+	if len(opt.Choices) != 3 || opt.Autocomplete {
+		t.Errorf("few: got %d choices and autocomplete %t, want 3 choices", len(opt.Choices), opt.Autocomplete)
+	}
+
+	opt = applicationCommandOption(many, false)
+	if len(opt.Choices) != 0 || !opt.Autocomplete {
+		t.Errorf("many: got %d choices and autocomplete %t, want autocomplete", len(opt.Choices), opt.Autocomplete)
+	}
+
+	// choice1 and choice10 to choice19
+	if n := len(optionChoices(many, "Choice1")); n != 11 {
+		t.Errorf("got %d suggestions for Choice1, want 11", n)
+	}
+}
+
+func TestHandleComponentMiddlewares(t *testing.T) {
+	_, m := newTestTransport(t, "")
+
+	err := HandleComponent(m, nil, "nothing:1")
+	if err != ErrUnknownComponent {
+		t.Errorf("unknown component: got error %v, want ErrUnknownComponent", err)
+	}
+
+	err = HandleComponent(m, nil, "page:expired:2")
+	if !errors.Is(err, ErrPagesExpired) {
+		t.Errorf("expired pages: got error %v, want ErrPagesExpired", err)
+	}
+
+	err = HandleComponent(m, nil, "testpanic:1")
+	if err != ErrCommandPanic {
+		t.Errorf("panicking handler: got error %v, want ErrCommandPanic", err)
+	}
+
+	Maintenance.Set(true, "")
+	defer Maintenance.Set(false, "")
+
+	err = HandleComponent(m, nil, "page:expired:2")
+	if _, ok := err.(*MaintenanceError); !ok {
+		t.Errorf("during maintenance: got error %v, want a MaintenanceError", err)
+	}
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +15,77 @@ func GetItemTypeById(id int) *ItemType {
 	return nil
 }
 
+// Finds an item type by id or name, in any language
+// Names don't have to be complete as long as only one item matches
+func FindItemType(str string) (*ItemType, error) {
+	if id, err := strconv.Atoi(str); err == nil {
+		itemType := GetItemTypeById(id)
+		if itemType == nil {
+			return nil, NewLocaleError("item.id_not_found", id)
+		}
+		return itemType, nil
+	}
+
+	var matches []*ItemType
+	for _, v := range ItemTypes {
+		matched := false
+		for _, name := range v.Names() {
+			if strings.EqualFold(name, str) {
+				return v, nil
+			}
+			if strings.Contains(strings.ToLower(name), strings.ToLower(str)) {
+				matched = true
+			}
+		}
+
+		if matched {
+			matches = append(matches, v)
+		}
+	}
+
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+
+	candidates := matches
+	if len(candidates) < 1 {
+		candidates = ItemTypes
+	}
+
+	names := make([]string, len(candidates))
+	for k, v := range candidates {
+		names[k] = fmt.Sprintf("%s (#%d)", v.Name, v.Id)
+	}
+
+	if len(matches) > 1 {
+		return nil, NewLocaleError("item.ambiguous", str, strings.Join(names, ", "))
+	}
+	itemNames := make([]string, 0, len(ItemTypes))
+	for _, v := range ItemTypes {
+		itemNames = append(itemNames, v.Names()...)
+	}
+	err := NewLocaleError("item.unknown", str, strings.Join(names, ", "))
+	return nil, WithSuggestion(err, str, itemNames)
+}
+
+// Returns the header and one line per item that can be equipped in slot, or all items if slot is EquipmentSlotNone
+func ItemListPages(slot EquipmentSlot, code string) (*Card, []string) {
+	card := &Card{
+		Title:       T(code, "item.list.title"),
+		Description: T(code, "item.list.description") + "\n",
+		Color:       ColorItem,
+	}
+
+	rows := make([]string, 0, len(ItemTypes))
+	for _, item := range ItemTypes {
+		if slot != EquipmentSlotNone && !item.CanEquipIn(slot) {
+			continue
+		}
+		rows = append(rows, fmt.Sprintf("[%d] - %s (%s) - %d$ - %s", item.Id, item.LocalName(code), item.SlotsString(code), item.Cost, item.LocalDescription(code)))
+	}
+	return card, rows
+}
+
 // General item definition
 type ItemType struct {
 	Id          int
@@ -30,6 +103,74 @@ type ItemType struct {
 	Item Item
 }
 
+// Returns the name of the item in language code, from the item.<id>.name message if translated
+func (it *ItemType) LocalName(code string) string {
+	return TFallback(code, fmt.Sprintf("item.%d.name", it.Id), it.Name)
+}
+
+// Returns the description of the item in language code, from the item.<id>.description message if translated
+func (it *ItemType) LocalDescription(code string) string {
+	return TFallback(code, fmt.Sprintf("item.%d.description", it.Id), it.Description)
+}
+
+// Returns the name of the item in every loaded language, without duplicates
+func (it *ItemType) Names() []string {
+	out := []string{it.Name}
+	seen := map[string]bool{it.Name: true}
+	for _, code := range Languages.Codes() {
+		name := it.LocalName(code)
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (it *ItemType) CanEquipIn(slot EquipmentSlot) bool {
+	for _, v := range it.Slots {
+		if v == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the slots this item can be equipped in, comma separated, in language code
+func (it *ItemType) SlotsString(code string) string {
+	out := ""
+	for k, slot := range it.Slots {
+		if k != 0 {
+			out += ", "
+		}
+		out += slot.LocalName(code)
+	}
+	return out
+}
+
+// Returns a card with detailed info about this item in language code
+func (it *ItemType) Card(code string) *Card {
+	card := &Card{
+		Title:       fmt.Sprintf("#%d - %s - $%d", it.Id, it.LocalName(code), it.Cost),
+		Description: it.LocalDescription(code),
+		Color:       ColorItem,
+	}
+
+	if len(it.Slots) > 0 {
+		card.AddField(T(code, "item.slots"), it.SlotsString(code), false)
+	}
+
+	pasiveEffects := it.Item.GetStaticAttributes()
+	if len(pasiveEffects) > 0 {
+		attributes := ""
+		for _, effect := range pasiveEffects {
+			attributes += fmt.Sprintf(" - %s: %.2f\n", effect.Type.LocalName(code), effect.Amount)
+		}
+		card.AddField(T(code, "item.attributes"), strings.TrimSuffix(attributes, "\n"), false)
+	}
+	return card
+}
+
 type Item interface {
 	Effect
 
@@ -75,27 +216,28 @@ func (slot EquipmentSlot) String() string {
 	return "Unknown"
 }
 
-func EquipmentSlotFromString(slot string) EquipmentSlot {
-	switch strings.ToLower(slot) {
+// Returns the name of the slot in language code
+func (slot EquipmentSlot) LocalName(code string) string {
+	return localName(code, "slot", slot.String())
+}
 
-	case "none":
-		return EquipmentSlotNone
-	case "head":
-		return EquipmentSlotHead
-	case "righthand":
-		return EquipmentSlotRightHand
-	case "lefthand":
-		return EquipmentSlotLeftHand
-	case "feet":
-		return EquipmentSlotFeet
-	case "torso":
-		return EquipmentSlotTorso
-	case "leggings":
-		return EquipmentSlotLeggings
+// Equipment slots as argument choices, does not include EquipmentSlotNone
+var EquipmentSlotChoices = []*ArgumentChoice{
+	&ArgumentChoice{Name: "head", Value: EquipmentSlotHead},
+	&ArgumentChoice{Name: "righthand", Aliases: []string{"rh", "right"}, Value: EquipmentSlotRightHand},
+	&ArgumentChoice{Name: "lefthand", Aliases: []string{"lh", "left"}, Value: EquipmentSlotLeftHand},
+	&ArgumentChoice{Name: "feet", Value: EquipmentSlotFeet},
+	&ArgumentChoice{Name: "torso", Value: EquipmentSlotTorso},
+	&ArgumentChoice{Name: "leggings", Aliases: []string{"legs"}, Value: EquipmentSlotLeggings},
+}
 
+// Parses an equipment slot, returning an error listing the valid slots if unknown
+func ParseEquipmentSlot(slot string) (EquipmentSlot, error) {
+	choice, err := FindChoice(EquipmentSlotChoices, "equipment slot", slot)
+	if err != nil {
+		return EquipmentSlotNone, err
 	}
-
-	return EquipmentSlotNone
+	return choice.Value.(EquipmentSlot), nil
 }
 
 // An item in a players inventory
@@ -131,6 +273,11 @@ func (i ItemAttributeType) String() string {
 	return "Unknown"
 }
 
+// Returns the name of the attribute in language code
+func (i ItemAttributeType) LocalName(code string) string {
+	return localName(code, "attribute", i.String())
+}
+
 type ItemAttribute struct {
 	Type   ItemAttributeType
 	Amount float32
@@ -0,0 +1,585 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Why money or items moved
+type LedgerReason string
+
+const (
+	ReasonBuy       LedgerReason = "buy"
+	ReasonGiveItem  LedgerReason = "give"
+	ReasonGiveMoney LedgerReason = "givemoney"
+	ReasonCreate    LedgerReason = "create" // Items created by bot owners
+	ReasonBattle    LedgerReason = "battle"
+	ReasonReversal  LedgerReason = "reversal"
+	ReasonCopy      LedgerReason = "copy"  // Global players copied into a servers economy
+	ReasonEdit      LedgerReason = "edit"  // Changed with battlebot-admin
+	ReasonMerge     LedgerReason = "merge" // Players taken from another save with battlebot-admin
+)
+
+var (
+	flagLedger string
+
+	Ledger = &LedgerFile{}
+
+	ErrNoLedger = NewLocaleError("ledger.not_open")
+)
+
+// A set of money and item movements that happened together, e.g both sides of a trade
+// Transactions are never changed once committed, mistakes are undone by committing a reversal
+type LedgerTx struct {
+	Id     int64
+	Time   time.Time
+	Reason LedgerReason
+
+	// The user that caused it, empty for the bot itself
+	Actor string `json:",omitempty"`
+
+	// The battle the transaction belongs to, if any
+	BattleId string `json:",omitempty"`
+
+	// Id of the transaction this one reverses, 0 if none
+	Reverses int64 `json:",omitempty"`
+
+	Changes []*LedgerChange
+
+	ledger *LedgerFile
+}
+
+// A change to one players money or inventory
+// XP, wins and attributes aren't recorded, they can't be traded or spent so there's nothing to audit or reverse
+type LedgerChange struct {
+	Player string
+
+	// The server whose economy the player is in, empty for the global one
+	Guild string `json:",omitempty"`
+
+	// Money added, negative if removed
+	Money int `json:",omitempty"`
+
+	// Item type id and how many were added, negative if removed, no item moved if ItemCount is 0
+	Item      int `json:",omitempty"`
+	ItemCount int `json:",omitempty"`
+}
+
+// Starts a transaction, apply the changes with its methods and then commit it
+func (l *LedgerFile) Begin(reason LedgerReason, actor string) *LedgerTx {
+	return &LedgerTx{
+		Reason: reason,
+		Actor:  actor,
+		ledger: l,
+	}
+}
+
+// Monsters aren't stored players, changes to them are applied but not recorded
+func (tx *LedgerTx) record(p *Player, change *LedgerChange) {
+	if p.Id == "" {
+		return
+	}
+	change.Player = p.Id
+	change.Guild = p.Guild
+	tx.Changes = append(tx.Changes, change)
+}
+
+// Returns the key of the changed player, see PlayerKey
+func (c *LedgerChange) Key() string {
+	return PlayerKey(c.Guild, c.Player)
+}
+
+// Adds amount to the players money, negative to remove money, p has to be locked
+func (tx *LedgerTx) AddMoney(p *Player, amount int) {
+	if amount == 0 {
+		return
+	}
+
+	p.Money += amount
+	tx.record(p, &LedgerChange{Money: amount})
+}
+
+// Adds a new item of type id to the players inventory, p has to be locked
+func (tx *LedgerTx) AddItem(p *Player, id int) *PlayerItem {
+	item := &PlayerItem{Id: id}
+	tx.GiveItem(p, item)
+	return item
+}
+
+// Adds item to the players inventory unequipped, p has to be locked
+func (tx *LedgerTx) GiveItem(p *Player, item *PlayerItem) {
+	item.EquipmentSlot = EquipmentSlotNone
+	p.Inventory = append(p.Inventory, item)
+	tx.record(p, &LedgerChange{Item: item.Id, ItemCount: 1})
+}
+
+// Removes the item in inventory slot from the player and returns it, nil if there is no such slot
+// p has to be locked
+func (tx *LedgerTx) TakeItem(p *Player, slot int) *PlayerItem {
+	if slot < 0 || slot >= len(p.Inventory) {
+		return nil
+	}
+
+	item := p.Inventory[slot]
+	p.Inventory = append(p.Inventory[:slot], p.Inventory[slot+1:]...)
+	tx.record(p, &LedgerChange{Item: item.Id, ItemCount: -1})
+	return item
+}
+
+// Records the money and items p has compared to old as changes, for players replaced as a whole
+// old is nil if p is new, neither is changed
+func (tx *LedgerTx) RecordReplace(old, p *Player) {
+	oldMoney := 0
+	items := make(map[int]int)
+	if old != nil {
+		oldMoney = old.Money
+		for _, v := range old.Inventory {
+			items[v.Id]--
+		}
+	}
+	for _, v := range p.Inventory {
+		items[v.Id]++
+	}
+
+	if p.Money != oldMoney {
+		tx.record(p, &LedgerChange{Money: p.Money - oldMoney})
+	}
+
+	ids := make([]int, 0, len(items))
+	for id, n := range items {
+		if n != 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		tx.record(p, &LedgerChange{Item: id, ItemCount: items[id]})
+	}
+}
+
+// Writes the transaction to the ledger, transactions without changes are skipped
+// The changes are already applied to the players, so failures are only logged
+func (tx *LedgerTx) Commit() {
+	if len(tx.Changes) < 1 {
+		return
+	}
+
+	err := tx.ledger.append(tx)
+	if err != nil {
+		log.Println("Failed writing to the ledger:", err, "Transaction:", tx.String())
+	}
+}
+
+// Returns the keys of the players the transaction changed, see PlayerKey
+func (tx *LedgerTx) Players() []string {
+	out := make([]string, 0, 2)
+	for _, v := range tx.Changes {
+		if !stringInSlice(v.Key(), out) {
+			out = append(out, v.Key())
+		}
+	}
+	return out
+}
+
+func (tx *LedgerTx) String() string {
+	out, _ := json.Marshal(tx)
+	return string(out)
+}
+
+// Returns a line describing how the transaction changed the player with key, in language code
+func (tx *LedgerTx) Row(key, code string) string {
+	changes := make([]string, 0)
+	for _, v := range tx.Changes {
+		if v.Key() != key {
+			continue
+		}
+
+		if v.Money != 0 {
+			changes = append(changes, fmt.Sprintf("%+d$", v.Money))
+		}
+
+		if v.ItemCount != 0 {
+			name := fmt.Sprintf("#%d", v.Item)
+			if itemType := GetItemTypeById(v.Item); itemType != nil {
+				name = itemType.LocalName(code)
+			}
+			changes = append(changes, fmt.Sprintf("%+d %s", v.ItemCount, name))
+		}
+	}
+
+	out := T(code, "ledger.row", tx.Id, tx.Time.UTC().Format("2006-01-02 15:04"), localName(code, "ledger.reason", string(tx.Reason)), strings.Join(changes, ", "))
+
+	others := make([]string, 0)
+	for _, v := range tx.Changes {
+		mention := "<@" + v.Player + ">"
+		if v.Key() != key && !stringInSlice(mention, others) {
+			others = append(others, mention)
+		}
+	}
+	if len(others) > 0 {
+		out += " " + T(code, "ledger.with", strings.Join(others, ", "))
+	}
+
+	if tx.BattleId != "" {
+		out += " " + T(code, "ledger.battle", tx.BattleId)
+	}
+	if tx.Reverses != 0 {
+		out += " " + T(code, "ledger.reverses", tx.Reverses)
+	}
+	return out
+}
+
+// Returns a card and one row per transaction showing how they changed player, for paginating
+func LedgerPages(player *Player, txs []*LedgerTx, code string) (*Card, []string) {
+	card := &Card{
+		Title: T(code, "ledger.title", player.Name),
+		Color: ColorItem,
+	}
+
+	if len(txs) < 1 {
+		card.Description = T(code, "ledger.none")
+		return card, nil
+	}
+
+	rows := make([]string, 0, len(txs))
+	for _, v := range txs {
+		rows = append(rows, v.Row(player.Key(), code))
+	}
+	return card, rows
+}
+
+// An append-only file with one json encoded LedgerTx per line
+type LedgerFile struct {
+	sync.Mutex
+	Path string
+
+	file   *os.File
+	size   int64 // Where the next transaction is written
+	lastId int64
+
+	// Where each transaction starts in the file by id, and the id of the reversal of each reversed transaction
+	// Built when opening so Get doesn't read the whole file, PlayerHistory still does
+	offsets   map[int64]int64
+	reversals map[int64]int64
+
+	// Held while reversing so a transaction can't be reversed twice at the same time
+	reverseLock sync.Mutex
+}
+
+// Opens the ledger set with -ledger
+func OpenConfiguredLedger() error {
+	return Ledger.Open(flagLedger)
+}
+
+// Opens or creates the ledger file at path
+func (l *LedgerFile) Open(path string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	l.Path = path
+	l.file = file
+	l.lastId = 0
+	l.offsets = make(map[int64]int64)
+	l.reversals = make(map[int64]int64)
+
+	// Continue numbering from the last transaction
+	l.size, err = l.scan(func(tx *LedgerTx, offset int64) {
+		if tx.Id > l.lastId {
+			l.lastId = tx.Id
+		}
+		l.index(tx, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	// End a line cut off by a crash so the next transaction starts on its own line
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > l.size {
+		_, err = file.Write([]byte{'\n'})
+		l.size = info.Size() + 1
+	}
+	return err
+}
+
+// Adds the transaction starting at offset to the index, l has to be locked
+func (l *LedgerFile) index(tx *LedgerTx, offset int64) {
+	l.offsets[tx.Id] = offset
+	if tx.Reverses != 0 {
+		l.reversals[tx.Reverses] = tx.Id
+	}
+}
+
+func (l *LedgerFile) Close() error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *LedgerFile) append(tx *LedgerTx) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return ErrNoLedger
+	}
+
+	l.lastId++
+	tx.Id = l.lastId
+	tx.Time = time.Now()
+
+	out, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+
+	out = append(out, '\n')
+	n, err := l.file.Write(out)
+	if err != nil {
+		return err
+	}
+
+	l.index(tx, l.size)
+	l.size += int64(n)
+	return l.file.Sync()
+}
+
+// Calls fn with every transaction in the file and the offset it starts at, oldest first
+// Lines that can't be decoded, like one cut off by a crash, are logged and skipped
+// Returns the offset after the last complete line
+func (l *LedgerFile) scan(fn func(tx *LedgerTx, offset int64)) (int64, error) {
+	if l.Path == "" {
+		return 0, ErrNoLedger
+	}
+
+	file, err := os.Open(l.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A last line without a newline was cut off while writing
+			if len(data) > 0 {
+				log.Printf("Skipping line %d of the ledger: it was cut off", line)
+			}
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		start := offset
+		offset += int64(len(data))
+		if len(bytes.TrimSpace(data)) < 1 {
+			continue
+		}
+
+		var tx *LedgerTx
+		err = json.Unmarshal(data, &tx)
+		if err != nil {
+			log.Printf("Skipping line %d of the ledger: %s", line, err)
+			continue
+		}
+		fn(tx, start)
+	}
+}
+
+// Reads the transaction starting at offset
+func (l *LedgerFile) read(offset int64) (*LedgerTx, error) {
+	file, err := os.Open(l.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	var tx *LedgerTx
+	err = json.Unmarshal(data, &tx)
+	return tx, err
+}
+
+// Returns the transactions that changed player, newest first
+// This reads the whole file, the ledger isn't indexed by player
+func (l *LedgerFile) PlayerHistory(player *Player) ([]*LedgerTx, error) {
+	key := player.Key()
+	out := make([]*LedgerTx, 0)
+	_, err := l.scan(func(tx *LedgerTx, offset int64) {
+		if stringInSlice(key, tx.Players()) {
+			out = append(out, tx)
+		}
+	})
+
+	// Newest first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, err
+}
+
+// Returns the transaction with id, and the transaction reversing it if it has been reversed
+func (l *LedgerFile) Get(id int64) (tx *LedgerTx, reversal *LedgerTx, err error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return nil, nil, ErrNoLedger
+	}
+
+	offset, ok := l.offsets[id]
+	if !ok {
+		return nil, nil, NewLocaleError("ledger.not_found", id)
+	}
+
+	tx, err = l.read(offset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if reversalId, ok := l.reversals[id]; ok {
+		reversal, err = l.read(l.offsets[reversalId])
+	}
+	return
+}
+
+// Undoes transaction id by committing a transaction with the opposite changes
+// Fails without changing anything if a player no longer has the money or items to give back
+func (l *LedgerFile) Reverse(id int64, actor string) (*LedgerTx, error) {
+	l.reverseLock.Lock()
+	defer l.reverseLock.Unlock()
+
+	original, reversal, err := l.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if reversal != nil {
+		return nil, NewLocaleError("ledger.already_reversed", id, reversal.Id)
+	}
+
+	// Lock in a fixed order so this can't deadlock with another transaction
+	ids := original.Players()
+	sort.Strings(ids)
+
+	players := make(map[string]*Player)
+	for _, v := range original.Changes {
+		p := Players.GetPlayer(v.Guild, v.Player)
+		if p == nil {
+			return nil, NewLocaleError("ledger.unknown_player", v.Player)
+		}
+		players[v.Key()] = p
+	}
+
+	for _, v := range ids {
+		players[v].Lock()
+		defer players[v].Unlock()
+	}
+
+	// Check everything first so the reversal is all or nothing
+	money := make(map[string]int)
+	items := make(map[string]map[int]int)
+	for _, v := range original.Changes {
+		money[v.Key()] += v.Money
+		if items[v.Key()] == nil {
+			items[v.Key()] = make(map[int]int)
+		}
+		items[v.Key()][v.Item] += v.ItemCount
+	}
+
+	for _, v := range ids {
+		p := players[v]
+		if money[v] > 0 && p.Money < money[v] {
+			return nil, NewLocaleError("ledger.reverse_no_money", p.Name, money[v])
+		}
+
+		for item, count := range items[v] {
+			if count > 0 && countItems(p, item) < count {
+				return nil, NewLocaleError("ledger.reverse_no_item", p.Name, item)
+			}
+		}
+	}
+
+	tx := l.Begin(ReasonReversal, actor)
+	tx.Reverses = original.Id
+	tx.BattleId = original.BattleId
+	for _, v := range original.Changes {
+		p := players[v.Key()]
+		tx.AddMoney(p, -v.Money)
+
+		for i := 0; i < v.ItemCount; i++ {
+			tx.TakeItem(p, lastItemSlot(p, v.Item))
+		}
+		for i := 0; i > v.ItemCount; i-- {
+			tx.AddItem(p, v.Item)
+		}
+	}
+
+	tx.Commit()
+	return tx, nil
+}
+
+// Returns an uncommitted transaction recording the money and items of p, a global player copied into a servers economy
+// Copying doesn't change the global player, so only the new server player is recorded
+func copyTx(p *Player, actor string) *LedgerTx {
+	tx := Ledger.Begin(ReasonCopy, actor)
+	tx.RecordReplace(nil, p)
+	return tx
+}
+
+// Returns how many items of type id the player has, p has to be locked
+func countItems(p *Player, id int) int {
+	n := 0
+	for _, v := range p.Inventory {
+		if v.Id == id {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns the last inventory slot with an item of type id, -1 if none, p has to be locked
+func lastItemSlot(p *Player, id int) int {
+	for i := len(p.Inventory) - 1; i >= 0; i-- {
+		if p.Inventory[i].Id == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Opens a ledger in a temporary directory
+func newTestLedger(t *testing.T) *LedgerFile {
+	l := &LedgerFile{}
+	err := l.Open(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// Replaces Players with a manager holding players for the test
+func withTestPlayers(t *testing.T, players ...*Player) {
+	old := Players
+	Players = &PlayerManager{Players: players}
+	t.Cleanup(func() { Players = old })
+}
+
+// Commits a transaction where from gives to money and an item of type item
+func commitTrade(l *LedgerFile, from, to *Player, money, item int) *LedgerTx {
+	tx := l.Begin(ReasonGiveItem, from.Id)
+	tx.AddMoney(from, -money)
+	tx.AddMoney(to, money)
+	tx.GiveItem(to, tx.TakeItem(from, lastItemSlot(from, item)))
+	tx.Commit()
+	return tx
+}
+
+// Returns the id of the LocaleError err is or wraps, empty if none
+func localeErrorID(err error) string {
+	var localeErr *LocaleError
+	if errors.As(err, &localeErr) {
+		return localeErr.ID
+	}
+	return ""
+}
+
+func TestLedgerAppendOnly(t *testing.T) {
+	l := newTestLedger(t)
+	alice := &Player{Id: "1", Name: "alice", Money: 100, Inventory: []*PlayerItem{{Id: 1}, {Id: 2}}}
+	bob := &Player{Id: "2", Name: "bob"}
+
+	first := commitTrade(l, alice, bob, 10, 1)
+	before, err := ioutil.ReadFile(l.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := commitTrade(l, alice, bob, 20, 2)
+	if first.Id != 1 || second.Id != 2 {
+		t.Errorf("got ids %d and %d, want 1 and 2", first.Id, second.Id)
+	}
+
+	// Nothing to record, nothing written
+	l.Begin(ReasonBuy, alice.Id).Commit()
+
+	after, err := ioutil.ReadFile(l.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(after, before) {
+		t.Error("committing changed the transactions already in the file")
+	}
+	if n := bytes.Count(after, []byte("\n")); n != 2 {
+		t.Errorf("got %d lines, want 2", n)
+	}
+
+	history, err := l.PlayerHistory(bob)
+	if err != nil {
+		t.Fatal("PlayerHistory:", err)
+	}
+	if len(history) != 2 || history[0].Id != second.Id || history[1].Id != first.Id {
+		t.Errorf("got history %v, want transactions 2 and 1", history)
+	}
+
+	// Reopening continues the numbering
+	l.Close()
+	err = l.Open(l.Path)
+	if err != nil {
+		t.Fatal("reopening:", err)
+	}
+	third := commitTrade(l, bob, alice, 5, 1)
+	if third.Id != 3 {
+		t.Errorf("got id %d after reopening, want 3", third.Id)
+	}
+
+	tx, _, err := l.Get(first.Id)
+	if err != nil || tx.String() != first.String() {
+		t.Errorf("Get(%d) = %v, %v, want %v", first.Id, tx, err, first)
+	}
+}
+
+func TestLedgerCutOffLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.jsonl")
+	err := ioutil.WriteFile(path, []byte(`{"Id":1,"Reason":"buy","Changes":[{"Player":"1","Money":-5}]}`+"\n"+`{"Id":2,"Rea`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &LedgerFile{}
+	err = l.Open(path)
+	if err != nil {
+		t.Fatal("Open:", err)
+	}
+	defer l.Close()
+
+	tx := commitTrade(l, &Player{Id: "1", Money: 10, Inventory: []*PlayerItem{{Id: 1}}}, &Player{Id: "2"}, 5, 1)
+	if tx.Id != 2 {
+		t.Errorf("got id %d, want 2", tx.Id)
+	}
+
+	got, _, err := l.Get(tx.Id)
+	if err != nil || got.String() != tx.String() {
+		t.Errorf("Get(%d) = %v, %v, want %v", tx.Id, got, err, tx)
+	}
+}
+
+func TestLedgerReverse(t *testing.T) {
+	l := newTestLedger(t)
+	alice := &Player{Id: "1", Name: "alice", Money: 100, Inventory: []*PlayerItem{{Id: 1}}}
+	bob := &Player{Id: "2", Name: "bob", Money: 5}
+	withTestPlayers(t, alice, bob)
+
+	trade := commitTrade(l, alice, bob, 30, 1)
+
+	reversal, err := l.Reverse(trade.Id, "owner")
+	if err != nil {
+		t.Fatal("Reverse:", err)
+	}
+	if reversal.Reverses != trade.Id || reversal.Reason != ReasonReversal || reversal.Actor != "owner" {
+		t.Errorf("got reversal %v", reversal)
+	}
+	if alice.Money != 100 || len(alice.Inventory) != 1 || bob.Money != 5 || len(bob.Inventory) != 0 {
+		t.Errorf("after reversing alice has %d$ and %d items, bob %d$ and %d items", alice.Money, len(alice.Inventory), bob.Money, len(bob.Inventory))
+	}
+
+	_, got, err := l.Get(trade.Id)
+	if err != nil || got == nil || got.Id != reversal.Id {
+		t.Errorf("Get(%d) returned the reversal %v, %v, want %v", trade.Id, got, err, reversal)
+	}
+
+	_, err = l.Reverse(trade.Id, "owner")
+	if localeErrorID(err) != "ledger.already_reversed" {
+		t.Errorf("reversing twice: got error %v, want ledger.already_reversed", err)
+	}
+	if alice.Money != 100 || bob.Money != 5 {
+		t.Errorf("reversing twice moved money: alice has %d$, bob %d$", alice.Money, bob.Money)
+	}
+
+	// The reversal itself can be reversed
+	_, err = l.Reverse(reversal.Id, "owner")
+	if err != nil {
+		t.Fatal("reversing the reversal:", err)
+	}
+	if alice.Money != 70 || bob.Money != 35 || len(bob.Inventory) != 1 {
+		t.Errorf("after reversing the reversal alice has %d$, bob %d$ and %d items", alice.Money, bob.Money, len(bob.Inventory))
+	}
+
+	_, err = l.Reverse(100, "owner")
+	if localeErrorID(err) != "ledger.not_found" {
+		t.Errorf("reversing an unknown transaction: got error %v, want ledger.not_found", err)
+	}
+}
+
+func TestLedgerReverseWouldGoNegative(t *testing.T) {
+	l := newTestLedger(t)
+	alice := &Player{Id: "1", Name: "alice", Money: 100, Inventory: []*PlayerItem{{Id: 1}}}
+	bob := &Player{Id: "2", Name: "bob"}
+	withTestPlayers(t, alice, bob)
+
+	trade := commitTrade(l, alice, bob, 30, 1)
+
+	// bob spent the money
+	bob.Money = 10
+	_, err := l.Reverse(trade.Id, "owner")
+	if localeErrorID(err) != "ledger.reverse_no_money" {
+		t.Errorf("got error %v, want ledger.reverse_no_money", err)
+	}
+
+	// and the item
+	bob.Money = 30
+	bob.Inventory = nil
+	_, err = l.Reverse(trade.Id, "owner")
+	if localeErrorID(err) != "ledger.reverse_no_item" {
+		t.Errorf("got error %v, want ledger.reverse_no_item", err)
+	}
+
+	// Nothing was changed or recorded
+	if alice.Money != 70 || len(alice.Inventory) != 0 || bob.Money != 30 {
+		t.Errorf("failed reversals changed players: alice has %d$ and %d items, bob %d$", alice.Money, len(alice.Inventory), bob.Money)
+	}
+	if _, reversal, err := l.Get(trade.Id); err != nil || reversal != nil {
+		t.Errorf("failed reversals were recorded: %v, %v", reversal, err)
+	}
+
+	file, err := ioutil.ReadFile(l.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(file, []byte("\n")); n != 1 {
+		t.Errorf("got %d lines, only the trade should be written", n)
+	}
+}
@@ -0,0 +1,364 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jonas747/battlebot/lang"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Used when a message is missing in the requested language, the bundled catalog for it is complete
+const FallbackLanguage = "en"
+
+var (
+	flagLanguage string
+	flagLangDir  string
+
+	Languages = NewLanguageManager()
+)
+
+func init() {
+	err := Languages.LoadFS(lang.Files)
+	if err != nil {
+		log.Println("Failed loading bundled languages:", err)
+	}
+}
+
+// A message in a catalog, either plain text or one text per plural form
+type CatalogMessage struct {
+	Text  string
+	Forms map[string]string
+}
+
+func (c *CatalogMessage) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &c.Text); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &c.Forms)
+}
+
+// Returns the text for plural form, falling back to "other"
+func (c *CatalogMessage) Form(form string) string {
+	if c.Forms == nil {
+		return c.Text
+	}
+	if text, ok := c.Forms[form]; ok {
+		return text
+	}
+	return c.Forms["other"]
+}
+
+// All messages in one language, keyed by message id
+type Catalog struct {
+	Code     string
+	Messages map[string]*CatalogMessage
+}
+
+// Returns the display name of the language, from the language.name message
+func (c *Catalog) Name() string {
+	if msg, ok := c.Messages["language.name"]; ok {
+		return msg.Text
+	}
+	return c.Code
+}
+
+// Returns the plural form ("one", "few", "many" or "other") to use for n in a language
+type PluralRule func(n int) string
+
+// Plural rules by language code, languages not in here use the english rule
+var PluralRules = map[string]PluralRule{
+	"en": pluralOneOther,
+	"fr": func(n int) string {
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+	"ja": pluralOther,
+	"ko": pluralOther,
+	"zh": pluralOther,
+	"ru": pluralSlavic,
+	"uk": pluralSlavic,
+	"pl": func(n int) string {
+		if n == 1 {
+			return "one"
+		}
+		if n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14) {
+			return "few"
+		}
+		return "many"
+	},
+}
+
+func pluralOneOther(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func pluralOther(n int) string {
+	return "other"
+}
+
+func pluralSlavic(n int) string {
+	if n%10 == 1 && n%100 != 11 {
+		return "one"
+	}
+	if n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14) {
+		return "few"
+	}
+	return "many"
+}
+
+// Returns the plural form for n in language code
+func PluralForm(code string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+
+	if rule, ok := PluralRules[code]; ok {
+		return rule(n)
+	}
+	if rule, ok := PluralRules[baseLanguage(code)]; ok {
+		return rule(n)
+	}
+	return pluralOneOther(n)
+}
+
+// Returns "pt" for "pt-BR"
+func baseLanguage(code string) string {
+	if i := strings.IndexAny(code, "-_"); i != -1 {
+		return code[:i]
+	}
+	return code
+}
+
+type LanguageManager struct {
+	sync.RWMutex
+	Catalogs map[string]*Catalog
+}
+
+func NewLanguageManager() *LanguageManager {
+	return &LanguageManager{Catalogs: make(map[string]*Catalog)}
+}
+
+// Loads every .json file in fsys as the catalog for the language named after the file
+// Messages are merged into already loaded catalogs, replacing messages with the same id
+func (lm *LanguageManager) LoadFS(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		var messages map[string]*CatalogMessage
+		err = json.Unmarshal(data, &messages)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+
+		code := strings.TrimSuffix(path.Base(name), ".json")
+
+		lm.Lock()
+		catalog, ok := lm.Catalogs[code]
+		if !ok {
+			catalog = &Catalog{Code: code, Messages: make(map[string]*CatalogMessage)}
+			lm.Catalogs[code] = catalog
+		}
+		for id, msg := range messages {
+			catalog.Messages[id] = msg
+		}
+		lm.Unlock()
+	}
+	return nil
+}
+
+// Loads the language files in dir, see LoadFS
+func (lm *LanguageManager) LoadDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	return lm.LoadFS(os.DirFS(dir))
+}
+
+// Returns the message with id in language code, falling back to the base language and then FallbackLanguage
+func (lm *LanguageManager) Lookup(code, id string) (*CatalogMessage, string, bool) {
+	lm.RLock()
+	defer lm.RUnlock()
+
+	for _, c := range []string{code, baseLanguage(code), FallbackLanguage} {
+		if catalog, ok := lm.Catalogs[c]; ok {
+			if msg, ok := catalog.Messages[id]; ok {
+				return msg, c, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+// Returns the codes of the loaded languages, sorted
+func (lm *LanguageManager) Codes() []string {
+	lm.RLock()
+	defer lm.RUnlock()
+
+	out := make([]string, 0, len(lm.Catalogs))
+	for code := range lm.Catalogs {
+		out = append(out, code)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Returns the catalog for code, nil if not loaded
+func (lm *LanguageManager) Get(code string) *Catalog {
+	lm.RLock()
+	defer lm.RUnlock()
+	return lm.Catalogs[code]
+}
+
+// Returns the loaded language matching code, ignoring case, with a suggestion if unknown
+func (lm *LanguageManager) Find(code string) (string, error) {
+	codes := lm.Codes()
+	for _, v := range codes {
+		if strings.EqualFold(v, code) {
+			return v, nil
+		}
+	}
+
+	err := NewLocaleError("language.unknown", code, strings.Join(codes, ", "))
+	return "", WithSuggestion(err, code, codes)
+}
+
+// Returns the display name of language code
+func LanguageName(code string) string {
+	if catalog := Languages.Get(code); catalog != nil {
+		return catalog.Name()
+	}
+	return code
+}
+
+// Returns the message with id in language code formatted with args, or id if there is no such message
+// Messages are fmt format strings, translators can reorder arguments with %[n]s
+func T(code, id string, args ...interface{}) string {
+	msg, _, ok := Languages.Lookup(code, id)
+	if !ok {
+		return id
+	}
+	return format(msg.Form("other"), args)
+}
+
+// Like T but picks the plural form for n, n is not included in args automatically
+func TN(code, id string, n int, args ...interface{}) string {
+	msg, found, ok := Languages.Lookup(code, id)
+	if !ok {
+		return id
+	}
+	return format(msg.Form(PluralForm(found, n)), args)
+}
+
+// Returns the message with id in language code, or fallback if there is no such message
+// Used for names that live in code, like items and monsters, and only need a message when translated
+func TFallback(code, id, fallback string) string {
+	msg, _, ok := Languages.Lookup(code, id)
+	if !ok {
+		return fallback
+	}
+	return msg.Form("other")
+}
+
+func format(text string, args []interface{}) string {
+	if len(args) < 1 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Returns the language for messages to a user in a guild: the users language, the guilds language or the default
+func LanguageFor(userID, guildID string) string {
+	// Languages are per user, so they're kept on the global player even in servers with a local economy
+	if player := Players.GetPlayer("", userID); player != nil {
+		player.RLock()
+		code := player.Language
+		player.RUnlock()
+		if code != "" {
+			return code
+		}
+	}
+
+	if code := Guilds.Language(guildID); code != "" {
+		return code
+	}
+	return DefaultLanguage()
+}
+
+// Returns the language used when neither the user nor the guild has picked one
+func DefaultLanguage() string {
+	if flagLanguage == "" {
+		return FallbackLanguage
+	}
+	return flagLanguage
+}
+
+// Loads the language files from -langdir, if set
+func LoadLanguageDir() {
+	if flagLangDir == "" {
+		return
+	}
+
+	err := Languages.LoadDir(flagLangDir)
+	if err != nil {
+		log.Println("Failed loading languages from", flagLangDir+":", err)
+	}
+}
+
+// Implemented by errors that can show themselves in another language
+type Localizer interface {
+	Localize(code string) string
+}
+
+// Returns err as text in language code
+func LocalizeError(code string, err error) string {
+	var l Localizer
+	if errors.As(err, &l) {
+		return l.Localize(code)
+	}
+	return err.Error()
+}
+
+// An error shown to users as a catalog message
+type LocaleError struct {
+	ID   string
+	Args []interface{}
+}
+
+func NewLocaleError(id string, args ...interface{}) *LocaleError {
+	return &LocaleError{ID: id, Args: args}
+}
+
+func (e *LocaleError) Error() string {
+	return e.Localize(FallbackLanguage)
+}
+
+func (e *LocaleError) Localize(code string) string {
+	return T(code, e.ID, e.Args...)
+}
+
+// Returns the name of a value in code, using the message prefix.<name in lower case> if it exists
+// Used to translate enum like values, e.g slots and attributes
+func localName(code, prefix, name string) string {
+	key := strings.ToLower(strings.Replace(name, " ", "_", -1))
+	return TFallback(code, prefix+"."+key, name)
+}
@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"expvar"
+	"github.com/bwmarrin/discordgo"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A single command being run, passed through the middleware chain
+type Invocation struct {
+	Cmd     *CommandDef
+	Message *discordgo.MessageCreate
+
+	// Set once the arguments have been parsed
+	Parsed *ParsedCommand
+
+	// Called right before the command is run, after all the middlewares passed
+	BeforeRun func()
+
+	// Parses the arguments, set by whatever received the command (a message or a slash command)
+	parse func() (*ParsedCommand, error)
+
+	// Run instead of the commands RunFunc if set, for component presses
+	run func(ctx *CommandContext) error
+}
+
+// Parses the arguments if not already done
+func (inv *Invocation) Parse() (*ParsedCommand, error) {
+	if inv.Parsed != nil {
+		return inv.Parsed, nil
+	}
+
+	parsed, err := inv.parse()
+	if err != nil {
+		return nil, err
+	}
+	inv.Parsed = parsed
+	return parsed, nil
+}
+
+// Runs an invocation, returning an error to be shown to the user
+type Handler func(inv *Invocation) error
+
+// Wraps a handler, it can do work before and after calling next, or return early without calling it
+type Middleware func(next Handler) Handler
+
+// Middlewares run on every command in order, the first one is the outermost
+var Middlewares = []Middleware{
+	LoggingMiddleware,
+	MetricsMiddleware,
+	ShutdownMiddleware,
+	MaintenanceMiddleware,
+	DisabledCommandsMiddleware,
+	PermissionMiddleware,
+	CooldownMiddleware,
+}
+
+// Adds middlewares to the end of the chain
+// Only safe to call before bot has started
+func RegisterMiddlewares(mws ...Middleware) {
+	Middlewares = append(Middlewares, mws...)
+}
+
+// Runs inv through the middleware chain and then the command itself
+func RunInvocation(inv *Invocation) error {
+	handler := runCommand
+	for i := len(Middlewares) - 1; i >= 0; i-- {
+		handler = Middlewares[i](handler)
+	}
+	return handler(inv)
+}
+
+// The end of the chain, parses the arguments and runs the command
+func runCommand(inv *Invocation) error {
+	parsed, err := inv.Parse()
+	if err != nil {
+		return err
+	}
+
+	if inv.BeforeRun != nil {
+		inv.BeforeRun()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	defer cancel()
+
+	run := inv.Cmd.RunFunc
+	if inv.run != nil {
+		run = inv.run
+	}
+
+	err = run(NewCommandContext(ctx, parsed, inv.Message))
+	if err != nil {
+		return &CommandError{Command: inv.Cmd.FullName(), Err: err}
+	}
+	return nil
+}
+
+func LoggingMiddleware(next Handler) Handler {
+	return func(inv *Invocation) error {
+		started := time.Now()
+		err := next(inv)
+
+		m := inv.Message
+		log.Printf("Command %q by %s (%s) in guild %q channel %s took %s, err: %v", inv.Cmd.FullName(), m.Author.Username, m.Author.ID, m.GuildID, m.ChannelID, time.Since(started), err)
+		return err
+	}
+}
+
+var (
+	// Exposed on /debug/vars when running with -d
+	metricCommandUses   = expvar.NewMap("command_uses")
+	metricCommandErrors = expvar.NewMap("command_errors")
+	metricCommandTime   = expvar.NewMap("command_time_ns")
+)
+
+func MetricsMiddleware(next Handler) Handler {
+	return func(inv *Invocation) error {
+		started := time.Now()
+		err := next(inv)
+
+		name := inv.Cmd.FullName()
+		metricCommandUses.Add(name, 1)
+		metricCommandTime.Add(name, int64(time.Since(started)))
+		if err != nil {
+			metricCommandErrors.Add(name, 1)
+		}
+		return err
+	}
+}
+
+var (
+	ErrCommandDisabled        = NewLocaleError("error.command_disabled")
+	ErrCommandDisabledChannel = NewLocaleError("error.command_disabled_channel")
+)
+
+// Returned when a command is used outside the channels a guild restricted commands to
+type ChannelError struct {
+	Channels []string
+}
+
+func (c *ChannelError) Error() string {
+	return c.Localize(FallbackLanguage)
+}
+
+func (c *ChannelError) Localize(code string) string {
+	mentions := make([]string, len(c.Channels))
+	for k, v := range c.Channels {
+		mentions[k] = "<#" + v + ">"
+	}
+	return T(code, "error.channel_not_allowed", strings.Join(mentions, ", "))
+}
+
+// Returns an error if cmd is disabled or can't be used in the channel m was sent in
+// Commands that can't be disabled can be used in every channel, so the settings can always be changed
+func CheckCommandAllowed(m *discordgo.MessageCreate, cmd *CommandDef) error {
+	if !cmd.CanDisable() {
+		return nil
+	}
+
+	if !Guilds.ChannelAllowed(m.GuildID, m.ChannelID) {
+		return &ChannelError{Channels: Guilds.AllowedChannels(m.GuildID)}
+	}
+
+	if Guilds.CommandDisabled(m.GuildID, "", cmd) {
+		return ErrCommandDisabled
+	}
+
+	if Guilds.CommandDisabled(m.GuildID, m.ChannelID, cmd) {
+		return ErrCommandDisabledChannel
+	}
+	return nil
+}
+
+// Returned to everyone but bot owners when maintenance mode is enabled
+type MaintenanceError struct {
+	Reason string
+}
+
+func (m *MaintenanceError) Error() string {
+	return m.Localize(FallbackLanguage)
+}
+
+func (m *MaintenanceError) Localize(code string) string {
+	if m.Reason == "" {
+		return T(code, "error.maintenance")
+	}
+	return T(code, "error.maintenance_reason", m.Reason)
+}
+
+var Maintenance = &MaintenanceMode{}
+
+// When enabled only bot owners can use commands
+type MaintenanceMode struct {
+	sync.RWMutex
+	Enabled bool
+	Reason  string
+}
+
+func (mm *MaintenanceMode) Set(enabled bool, reason string) {
+	mm.Lock()
+	mm.Enabled = enabled
+	mm.Reason = reason
+	mm.Unlock()
+}
+
+// Returns a MaintenanceError if maintenance mode is enabled
+func (mm *MaintenanceMode) Check() error {
+	mm.RLock()
+	defer mm.RUnlock()
+
+	if !mm.Enabled {
+		return nil
+	}
+	return &MaintenanceError{Reason: mm.Reason}
+}
+
+func MaintenanceMiddleware(next Handler) Handler {
+	return func(inv *Invocation) error {
+		if !IsOwner(inv.Message.Author.ID) {
+			if err := Maintenance.Check(); err != nil {
+				return err
+			}
+		}
+		return next(inv)
+	}
+}
+
+func DisabledCommandsMiddleware(next Handler) Handler {
+	return func(inv *Invocation) error {
+		if err := CheckCommandAllowed(inv.Message, inv.Cmd); err != nil {
+			return err
+		}
+		return next(inv)
+	}
+}
+
+func PermissionMiddleware(next Handler) Handler {
+	return func(inv *Invocation) error {
+		if err := CheckPermission(inv.Message, inv.Cmd); err != nil {
+			return err
+		}
+		return next(inv)
+	}
+}
+
+func CooldownMiddleware(next Handler) Handler {
+	return func(inv *Invocation) error {
+		// Parse first so invalid arguments don't put the command on cooldown
+		if _, err := inv.Parse(); err != nil {
+			return err
+		}
+
+		if err := Cooldowns.Use(inv.Message.Author.ID, inv.Cmd); err != nil {
+			return err
+		}
+
+		// Only commands that succeed go on cooldown
+		err := next(inv)
+		if err != nil {
+			Cooldowns.Undo(inv.Message.Author.ID, inv.Cmd)
+		}
+		return err
+	}
+}
+
+// Returns true for errors meant to be shown to the user as they are, rather than as a failed command
+func IsNoticeError(err error) bool {
+	switch err.(type) {
+	case *CooldownError, *PermissionError, *MaintenanceError, *ChannelError, *CommandError:
+		return true
+	}
+	return err == ErrCommandDisabled || err == ErrCommandDisabledChannel || err == ErrShuttingDown
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Version of the player format saved by this version of the bot
+// Bump it and add a migration to PlayerMigrations when changing Player, PlayerItem or AttributeContainer
+// in a way older saves wouldn't decode into correctly, e.g renaming, removing or changing the type of a field
+const PlayerSchemaVersion = 2
+
+// Changes a player saved in one version into the next version
+// Players are decoded into generic json so fields that no longer exist can still be read
+type PlayerMigration func(player map[string]interface{}) error
+
+// Migrations by the version they migrate from, PlayerMigrations[v] turns a version v player into version v+1
+var PlayerMigrations = map[int]PlayerMigration{
+	// Saves from before there were versions, the format is the same as version 1
+	0: func(player map[string]interface{}) error { return nil },
+
+	// Version 2 added per server economies, every version 1 player is in the global one
+	// There is nothing to change, the bump keeps older bots from loading server players as global ones
+	1: func(player map[string]interface{}) error { return nil },
+}
+
+// Returned when a save is from a newer version of the bot, loading it could lose data that version added
+type SchemaVersionError struct {
+	Version int
+}
+
+func (s *SchemaVersionError) Error() string {
+	return fmt.Sprintf("save is from a newer version of the bot (player format %d, this version supports up to %d)", s.Version, PlayerSchemaVersion)
+}
+
+// Returns data, a player saved in version, migrated to PlayerSchemaVersion
+func MigratePlayer(data []byte, version int) ([]byte, error) {
+	if version > PlayerSchemaVersion {
+		return nil, &SchemaVersionError{Version: version}
+	}
+
+	if version == PlayerSchemaVersion {
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var player map[string]interface{}
+	err := decoder.Decode(&player)
+	if err != nil {
+		return nil, err
+	}
+
+	for v := version; v < PlayerSchemaVersion; v++ {
+		migration, ok := PlayerMigrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration for players from version %d", v)
+		}
+
+		err = migration(player)
+		if err != nil {
+			return nil, fmt.Errorf("migrating player %v from version %d: %s", player["Id"], v, err)
+		}
+	}
+
+	return json.Marshal(player)
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Copies the fixture testdata/name to dir/as and returns the new path
+func copyFixture(t *testing.T, dir, name, as string) string {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, as)
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Opens the json store at path and checks it has alice with money and bob
+// Then saves it and checks the file was rewritten in the current format
+func checkMigratedStore(t *testing.T, path string, money int) {
+	store, err := OpenJSONStore(path, 0)
+	if err != nil {
+		t.Fatal("OpenJSONStore:", err)
+	}
+
+	alice, err := store.GetPlayer("101")
+	if err != nil || alice == nil {
+		t.Fatalf("alice wasn't loaded: %v", err)
+	}
+	if alice.Name != "alice" || alice.Money != money || alice.XP != 45 || alice.Guild != "" {
+		t.Errorf("alice loaded as %s, %d$, %d XP in economy %q, want alice, %d$, 45 XP in the global one", alice.Name, alice.Money, alice.XP, alice.Guild, money)
+	}
+	if len(alice.Inventory) < 1 || alice.Inventory[0].Id != 1 || alice.Attributes.Get(AttributeStrength) != 2 {
+		t.Errorf("alice lost items or attributes: %+v", alice)
+	}
+
+	bob, err := store.GetPlayer("102")
+	if err != nil || bob == nil {
+		t.Fatalf("bob wasn't loaded: %v", err)
+	}
+
+	bob.Money += 5
+	err = store.PutPlayer(bob)
+	if err != nil {
+		t.Fatal("PutPlayer:", err)
+	}
+
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, version, err := decodeSaveFile(file)
+	if err != nil {
+		t.Fatal("decoding the saved file:", err)
+	}
+	if version != PlayerSchemaVersion {
+		t.Errorf("saved in version %d, want %d", version, PlayerSchemaVersion)
+	}
+
+	reopened, err := OpenJSONStore(path, 0)
+	if err != nil {
+		t.Fatal("reopening:", err)
+	}
+	players, err := reopened.ListPlayers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(players) != 2 {
+		t.Errorf("got %d players after saving, want 2", len(players))
+	}
+}
+
+func TestMigrateVersion0(t *testing.T) {
+	path := copyFixture(t, t.TempDir(), "players_v0.json", "players.json")
+	checkMigratedStore(t, path, 120)
+}
+
+func TestMigrateVersion1(t *testing.T) {
+	path := copyFixture(t, t.TempDir(), "players_v1.json", "players.json")
+	checkMigratedStore(t, path, 120)
+}
+
+func TestChecksumMismatchFallsBack(t *testing.T) {
+	dir := t.TempDir()
+	path := copyFixture(t, dir, "players_corrupt.json", "players.json")
+	copyFixture(t, dir, "players_corrupt.json.20240101-120000.000", "players.json.20240101-120000.000")
+
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := decodeSaveFile(file); err == nil {
+		t.Fatal("the corrupt fixture passed the checksum")
+	}
+
+	// The previous generation has alice with 100$ instead of 120$
+	checkMigratedStore(t, path, 100)
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	_, err := MigratePlayer([]byte(`{"Id":"101"}`), PlayerSchemaVersion+1)
+
+	var versionErr *SchemaVersionError
+	if !errors.As(err, &versionErr) {
+		t.Errorf("got error %v, want a SchemaVersionError", err)
+	}
+}
+
+func TestMigratePlayerRunsEachStep(t *testing.T) {
+	old := PlayerMigrations
+	defer func() { PlayerMigrations = old }()
+
+	ran := make([]int, 0)
+	PlayerMigrations = make(map[int]PlayerMigration)
+	for v := 0; v < PlayerSchemaVersion; v++ {
+		v := v
+		PlayerMigrations[v] = func(player map[string]interface{}) error {
+			ran = append(ran, v)
+			player["Name"] = player["Name"].(string) + "+"
+			return nil
+		}
+	}
+
+	migrated, err := MigratePlayer([]byte(`{"Id":"101","Name":"alice"}`), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ran) != PlayerSchemaVersion {
+		t.Errorf("ran migrations %v, want one from every version below %d", ran, PlayerSchemaVersion)
+	}
+	p, err := decodePlayer(migrated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "alice++" {
+		t.Errorf("migrated name is %q, want %q", p.Name, "alice++")
+	}
+}
+
+func TestJSONStoreReadOnly(t *testing.T) {
+	path := copyFixture(t, t.TempDir(), "players_v0.json", "players.json")
+	before, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenStoreReadOnly("json", path)
+	if err != nil {
+		t.Fatal("OpenStoreReadOnly:", err)
+	}
+	alice, err := store.GetPlayer("101")
+	if err != nil || alice == nil || alice.Money != 120 {
+		t.Errorf("alice loaded as %+v, %v", alice, err)
+	}
+
+	err = store.PutPlayer(alice)
+	if err != ErrReadOnly {
+		t.Errorf("writing: got error %v, want ErrReadOnly", err)
+	}
+
+	after, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("the read only store changed the file")
+	}
+}
@@ -30,6 +30,11 @@ func (mm MonsterModifier) String() string {
 	return "???"
 }
 
+// Returns the name of the modifier in language code
+func (mm MonsterModifier) LocalName(code string) string {
+	return localName(code, "monster.modifier", mm.String())
+}
+
 var MonsterTypes = []*MonsterType{
 	&MonsterType{
 		Name:     "Blob",
@@ -79,13 +84,19 @@ type MonsterType struct {
 	LvlEnd   int
 }
 
-func GetMonster(level int) *Monster {
+// Returns the name of the monster type in language code
+func (mt *MonsterType) LocalName(code string) string {
+	return localName(code, "monster", mt.Name)
+}
+
+// Returns a random monster at level, named in language code
+func GetMonster(level int, code string) *Monster {
 	monsterType := RandomMonsterType(level)
 	modifier := RandomMonsterModifier()
 
 	monster := &Monster{
 		Player: &Player{
-			Name:  modifier.String() + " " + monsterType.Name,
+			Name:  T(code, "monster.name", modifier.LocalName(code), monsterType.LocalName(code)),
 			XP:    GetXPForLevel((level - 1) + int(modifier)),
 			Money: 2 + int(modifier)*2,
 		},
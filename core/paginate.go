@@ -0,0 +1,213 @@
+package core
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPageSize = 10
+
+	// How long the next/prev buttons keep working
+	PageTimeout = time.Minute * 10
+)
+
+// Added to commands that show paginated output, as an argument or flag
+var PageArgument = &ArgumentDef{Name: "page", Description: "The page to show", Type: ArgumentTypeNumber}
+
+var (
+	ErrPagesExpired = NewLocaleError("pages.expired")
+	ErrNotYourPages = NewLocaleError("pages.not_yours")
+)
+
+// Splits rows into pages rendered as cards, with next/prev buttons when there's more than one page
+type Paginator struct {
+	Id       string
+	Owner    string // Only the owner can use the buttons
+	Card     *Card  // The title, description and color of every page, rows go below the description
+	Rows     []string
+	PerPage  int
+	Language string
+
+	Channel   string
+	MessageID string
+	Created   time.Time
+}
+
+func NewPaginator(card *Card, rows []string, perPage int) *Paginator {
+	if perPage < 1 {
+		perPage = DefaultPageSize
+	}
+
+	return &Paginator{
+		Id:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		Card:     card,
+		Rows:     rows,
+		PerPage:  perPage,
+		Language: DefaultLanguage(),
+		Created:  time.Now(),
+	}
+}
+
+func (p *Paginator) NumPages() int {
+	pages := (len(p.Rows) + p.PerPage - 1) / p.PerPage
+	if pages < 1 {
+		return 1
+	}
+	return pages
+}
+
+// Returns an error if page is out of range, pages start at 1
+func (p *Paginator) CheckPage(page int) error {
+	if page < 1 || page > p.NumPages() {
+		return NewLocaleError("pages.out_of_range", page, p.NumPages())
+	}
+	return nil
+}
+
+// Returns the card for page, pages start at 1
+func (p *Paginator) Page(page int) *Card {
+	start := (page - 1) * p.PerPage
+	end := start + p.PerPage
+	if end > len(p.Rows) {
+		end = len(p.Rows)
+	}
+
+	card := *p.Card
+	for _, row := range p.Rows[start:end] {
+		card.Description += row + "\n"
+	}
+
+	if p.NumPages() > 1 {
+		footer := T(p.Language, "pages.footer", page, p.NumPages())
+		if card.Footer != "" {
+			footer += " | " + card.Footer
+		}
+		card.Footer = footer
+	}
+	return &card
+}
+
+// Returns the message for page rendered by the transports renderer, with buttons if there's more than one page
+func (p *Paginator) Message(page int) *discordgo.MessageSend {
+	msg := transport.Renderer().Render(p.Page(page))
+	msg.Components = p.buttons(page)
+	return msg
+}
+
+func (p *Paginator) buttons(page int) []discordgo.MessageComponent {
+	if p.NumPages() < 2 {
+		return []discordgo.MessageComponent{}
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: T(p.Language, "pages.prev"), Style: discordgo.SecondaryButton, CustomID: "page:" + p.Id + ":" + strconv.Itoa(page-1), Disabled: page <= 1},
+				discordgo.Button{Label: T(p.Language, "pages.next"), Style: discordgo.SecondaryButton, CustomID: "page:" + p.Id + ":" + strconv.Itoa(page+1), Disabled: page >= p.NumPages()},
+			},
+		},
+	}
+}
+
+// Sends page to channel, keeping track of the message for the buttons if there's more than one page
+func (p *Paginator) Send(channel string, page int) error {
+	if transport == nil {
+		return ErrNoTransport
+	}
+
+	if err := p.CheckPage(page); err != nil {
+		return err
+	}
+
+	msg, err := transport.SendComplex(channel, p.Message(page))
+	if err != nil {
+		return err
+	}
+
+	if p.NumPages() > 1 {
+		p.Channel = channel
+		p.MessageID = msg.ID
+		Pages.Add(p)
+	}
+	return nil
+}
+
+// Replaces the message with page
+func (p *Paginator) Show(page int) error {
+	if err := p.CheckPage(page); err != nil {
+		return err
+	}
+
+	msg := p.Message(page)
+
+	edit := discordgo.NewMessageEdit(p.Channel, p.MessageID)
+	if msg.Content != "" {
+		edit.SetContent(msg.Content)
+	}
+	if len(msg.Embeds) > 0 {
+		edit.Embeds = &msg.Embeds
+	}
+	edit.Components = &msg.Components
+
+	_, err := transport.EditComplex(edit)
+	return err
+}
+
+var Pages = &PageManager{Paginators: make(map[string]*Paginator)}
+
+// Keeps track of sent paginators so the buttons work until they time out
+type PageManager struct {
+	sync.Mutex
+	Paginators map[string]*Paginator
+}
+
+// Adds p, removing timed out paginators
+func (pm *PageManager) Add(p *Paginator) {
+	pm.Lock()
+	defer pm.Unlock()
+
+	for id, v := range pm.Paginators {
+		if time.Since(v.Created) > PageTimeout {
+			delete(pm.Paginators, id)
+		}
+	}
+	pm.Paginators[p.Id] = p
+}
+
+// Returns the paginator with id, nil if it doesn't exist or timed out
+func (pm *PageManager) Get(id string) *Paginator {
+	pm.Lock()
+	defer pm.Unlock()
+
+	p, ok := pm.Paginators[id]
+	if !ok || time.Since(p.Created) > PageTimeout {
+		return nil
+	}
+	return p
+}
+
+// Handles the next and prev buttons on paginated messages
+// args is the custom id split by ':', without the leading "page"
+func HandlePageComponent(user *discordgo.User, msg *discordgo.Message, args []string) error {
+	if len(args) < 2 {
+		return ErrPagesExpired
+	}
+
+	p := Pages.Get(args[0])
+	if p == nil {
+		return ErrPagesExpired
+	}
+
+	if p.Owner != "" && p.Owner != user.ID {
+		return ErrNotYourPages
+	}
+
+	page, err := strconv.Atoi(args[1])
+	if err != nil {
+		return ErrPagesExpired
+	}
+	return p.Show(page)
+}
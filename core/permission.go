@@ -0,0 +1,105 @@
+package core
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"strings"
+)
+
+type PermissionLevel int
+
+const (
+	PermissionUser PermissionLevel = iota
+	PermissionModerator
+	PermissionAdmin // Server admins, either by discord permissions or admin roles
+	PermissionOwner // Bot owners, set with the -owners flag
+)
+
+func (p PermissionLevel) String() string {
+	switch p {
+	case PermissionUser:
+		return "User"
+	case PermissionModerator:
+		return "Moderator"
+	case PermissionAdmin:
+		return "Admin"
+	case PermissionOwner:
+		return "Bot owner"
+	}
+	return "Unknown"
+}
+
+// Returns the name of the level in language code
+func (p PermissionLevel) LocalName(code string) string {
+	return localName(code, "permission", p.String())
+}
+
+// Levels that can be given to roles as argument choices
+var RolePermissionChoices = []*ArgumentChoice{
+	&ArgumentChoice{Name: "moderator", Aliases: []string{"mod"}, Value: PermissionModerator},
+	&ArgumentChoice{Name: "admin", Value: PermissionAdmin},
+}
+
+var (
+	flagOwners string
+)
+
+// Returned when someone tries to use a command above their permission level
+type PermissionError struct {
+	Command  string
+	Required PermissionLevel
+}
+
+func (p *PermissionError) Error() string {
+	return p.Localize(FallbackLanguage)
+}
+
+func (p *PermissionError) Localize(code string) string {
+	return T(code, "error.permission", p.Required.LocalName(code), p.Command)
+}
+
+func IsOwner(userID string) bool {
+	for _, v := range strings.Split(flagOwners, ",") {
+		if v = strings.TrimSpace(v); v != "" && v == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the permission level of the author of m
+func GetPermissionLevel(m *discordgo.MessageCreate) PermissionLevel {
+	if IsOwner(m.Author.ID) {
+		return PermissionOwner
+	}
+
+	if m.GuildID == "" {
+		return PermissionUser
+	}
+
+	if IsGuildAdmin(m) {
+		return PermissionAdmin
+	}
+
+	member, err := transport.GuildMember(m.GuildID, m.Author.ID)
+	if err != nil {
+		return PermissionUser
+	}
+
+	return Guilds.RolesPermissionLevel(m.GuildID, member.Roles)
+}
+
+func HasPermission(m *discordgo.MessageCreate, level PermissionLevel) bool {
+	if level == PermissionUser {
+		return true
+	}
+	return GetPermissionLevel(m) >= level
+}
+
+// Returns a PermissionError if the author of m can't use cmd
+func CheckPermission(m *discordgo.MessageCreate, cmd *CommandDef) error {
+	required := cmd.RequiredPermission()
+	if !HasPermission(m, required) {
+		return &PermissionError{Command: cmd.FullName(), Required: required}
+	}
+	return nil
+}
@@ -1,13 +1,12 @@
 package core
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/bwmarrin/discordgo"
-	"io/ioutil"
 	"log"
-	"os"
+	"sort"
 	"sync"
 	"time"
 )
@@ -19,66 +18,171 @@ var (
 type PlayerManager struct {
 	sync.RWMutex
 	Players []*Player
+
+	// Where players are loaded from and saved to, has to be set before calling Load or Save
+	Store Store
+
+	// The players as they were last loaded or saved, used to only save the changed ones
+	saved   map[string][]byte
+	savedMu sync.Mutex
+
+	// Closed by Stop to end the save loop in Run
+	stop     chan bool
+	stopOnce sync.Once
+	running  sync.WaitGroup
+}
+
+// Runs Run in the background, Stop waits for it to return
+func (pm *PlayerManager) Start() {
+	pm.running.Add(1)
+	go func() {
+		defer pm.running.Done()
+		pm.Run()
+	}()
 }
 
+// Loads the players and then saves the changed ones every minute until Stop is called, see Start
 func (pm *PlayerManager) Run() {
+	stop := pm.stopChan()
+	select {
+	case <-stop:
+		return
+	default:
+	}
+
 	err := pm.Load()
 	if err != nil {
-		log.Println("Failed loading data, consider using backup")
+		log.Println("Failed loading players:", err)
 	}
 
 	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
 			err := pm.Save()
 			if err != nil {
-				log.Printf("Error saving log: ", err)
+				log.Println("Error saving players:", err)
 			}
+		case <-stop:
+			return
 		}
 	}
 }
 
+// Stops the saves Run does every minute and waits for the Run started by Start to return, so the store can be closed
+func (pm *PlayerManager) Stop() {
+	pm.stopOnce.Do(func() {
+		close(pm.stopChan())
+	})
+	pm.running.Wait()
+}
+
+func (pm *PlayerManager) stopChan() chan bool {
+	pm.Lock()
+	defer pm.Unlock()
+
+	if pm.stop == nil {
+		pm.stop = make(chan bool)
+	}
+	return pm.stop
+}
+
+// Replaces the players in memory with the ones in the store
 func (pm *PlayerManager) Load() error {
-	file, err := ioutil.ReadFile("players.json")
-	if err != nil {
-		return err
+	if pm.Store == nil {
+		return ErrNoStore
 	}
-	var decoded []*Player
-	err = json.Unmarshal(file, &decoded)
+
+	decoded, err := pm.Store.ListPlayers()
 	if err != nil {
 		return err
 	}
 
+	saved := make(map[string][]byte)
+	for _, v := range decoded {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		saved[v.Key()] = data
+	}
+
+	pm.savedMu.Lock()
+	pm.saved = saved
+	pm.savedMu.Unlock()
+
 	pm.Lock()
 	pm.Players = decoded
 	pm.Unlock()
 	return nil
 }
 
+// Writes the players that changed since they were last loaded or saved to the store, in one transaction
 func (pm *PlayerManager) Save() error {
-	// Rotate savedata if existing
-	_, err := os.Stat("players.json")
-	if err == nil {
-		err = CopyFile("players.json", "players.json.1")
+	if pm.Store == nil {
+		return ErrNoStore
+	}
+
+	pm.savedMu.Lock()
+	defer pm.savedMu.Unlock()
+
+	pm.RLock()
+	players := make([]*Player, len(pm.Players))
+	copy(players, pm.Players)
+	pm.RUnlock()
+
+	changed := make(map[string][]byte)
+	for _, p := range players {
+		p.RLock()
+		data, err := json.Marshal(p)
+		key := p.Key()
+		p.RUnlock()
 		if err != nil {
 			return err
 		}
+
+		if old, ok := pm.saved[key]; !ok || !bytes.Equal(old, data) {
+			changed[key] = data
+		}
 	}
 
-	pm.Lock()
-	out, err := json.Marshal(pm.Players)
-	pm.Unlock()
-	if err != nil {
-		return err
+	if len(changed) < 1 {
+		return nil
 	}
 
-	file, err := os.Create("players.json")
+	err := pm.Store.Update(func(tx StoreTx) error {
+		for _, data := range changed {
+			// Store a copy so the player can't change while it's being written
+			snapshot, err := decodePlayer(data)
+			if err != nil {
+				return err
+			}
+
+			err = tx.PutPlayer(snapshot)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	file.Write(out)
-	return file.Close()
+
+	if pm.saved == nil {
+		pm.saved = make(map[string][]byte)
+	}
+	for key, data := range changed {
+		pm.saved[key] = data
+	}
+	return nil
 }
 
 func (pm *PlayerManager) AddPlayer(player *Player, lock bool) {
@@ -90,28 +194,159 @@ func (pm *PlayerManager) AddPlayer(player *Player, lock bool) {
 	pm.Players = append(pm.Players, player)
 }
 
-func (pm *PlayerManager) GetCreatePlayer(id, name string) *Player {
+// Returns the player with id in the economy of guild, empty for the global one, nil if it doesn't exist
+func (pm *PlayerManager) GetPlayer(guild, id string) *Player {
+	pm.RLock()
+	defer pm.RUnlock()
+
+	for _, v := range pm.Players {
+		if v.Id == id && v.Guild == guild {
+			return v
+		}
+	}
+	return nil
+}
+
+// A player and the value it was ranked by
+type LeaderboardEntry struct {
+	Id    string
+	Name  string
+	Value int
+}
+
+// Returns the players in the economy of guild ranked by value, highest first
+func (pm *PlayerManager) Leaderboard(guild string, value func(p *Player) int) []*LeaderboardEntry {
+	pm.RLock()
+	out := make([]*LeaderboardEntry, 0, len(pm.Players))
+	for _, v := range pm.Players {
+		if v.Guild != guild {
+			continue
+		}
+
+		v.RLock()
+		out = append(out, &LeaderboardEntry{Id: v.Id, Name: v.Name, Value: value(v)})
+		v.RUnlock()
+	}
+	pm.RUnlock()
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Value > out[j].Value
+	})
+	return out
+}
+
+// Returns the player with id in the economy of guild, empty for the global one, creating it if it doesn't exist
+func (pm *PlayerManager) GetCreatePlayer(guild, id, name string) *Player {
 	pm.Lock()
 	defer pm.Unlock()
 
 	for _, v := range pm.Players {
-		if v.Id == id {
+		if v.Id == id && v.Guild == guild {
 			return v
 		}
 	}
 
 	player := &Player{
-		Name: name,
-		Id:   id,
+		Name:  name,
+		Id:    id,
+		Guild: guild,
 	}
 	pm.AddPlayer(player, false)
 	return player
 }
 
+// Copies every global player into the economy of guild, skipping people who already played there
+// Returns how many were copied
+func (pm *PlayerManager) CopyToGuild(guild, actor string) (int, error) {
+	txs, err := pm.copyToGuild(guild, actor)
+	if err != nil {
+		return 0, err
+	}
+
+	// Written after unlocking so other commands don't wait for the ledger
+	for _, v := range txs {
+		v.Commit()
+	}
+	return len(txs), nil
+}
+
+// Copies the players and returns the ledger transactions recording what they started with
+func (pm *PlayerManager) copyToGuild(guild, actor string) ([]*LedgerTx, error) {
+	pm.Lock()
+	defer pm.Unlock()
+
+	existing := make(map[string]*Player)
+	for _, v := range pm.Players {
+		if v.Guild == guild {
+			existing[v.Id] = v
+		}
+	}
+
+	txs := make([]*LedgerTx, 0)
+	copied := make([]*Player, 0)
+	for _, v := range pm.Players {
+		if v.Guild != "" {
+			continue
+		}
+
+		// Profiles that were only looked at, e.g with stats, haven't been played on and get replaced
+		local := existing[v.Id]
+		if local != nil {
+			local.RLock()
+			fresh := local.Fresh()
+			local.RUnlock()
+			if !fresh {
+				continue
+			}
+		}
+
+		v.RLock()
+		data, err := json.Marshal(v)
+		v.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := decodePlayer(data)
+		if err != nil {
+			return nil, err
+		}
+		p.Guild = guild
+		p.Language = "" // Only read from the global player, see LanguageFor
+
+		if local != nil {
+			// Others may already have a pointer to it, so the existing player is updated instead of replaced
+			local.Lock()
+			local.XP = p.XP
+			local.Money = p.Money
+			local.Wins = p.Wins
+			local.Losses = p.Losses
+			local.Attributes = p.Attributes
+			local.Inventory = p.Inventory
+			local.History = p.History
+			txs = append(txs, copyTx(local, actor))
+			local.Unlock()
+			continue
+		}
+
+		copied = append(copied, p)
+		txs = append(txs, copyTx(p, actor))
+	}
+
+	for _, v := range copied {
+		pm.AddPlayer(v, false)
+	}
+	return txs, nil
+}
+
 type Player struct {
 	sync.RWMutex
-	Name  string
-	Id    string
+	Name string
+	Id   string // Discord user id
+
+	// The server whose economy this player belongs to, empty for the global economy
+	Guild string `json:",omitempty"`
+
 	XP    int
 	Money int
 
@@ -120,6 +355,30 @@ type Player struct {
 
 	Attributes AttributeContainer
 	Inventory  []*PlayerItem
+
+	// Language code messages to this player are in, empty to use the servers language
+	Language string
+
+	// The most recent battles, newest last
+	History []*BattleRecord
+}
+
+// Returns the key of the player with id in the economy of guild, unique across all economies
+func PlayerKey(guild, id string) string {
+	if guild == "" {
+		return id
+	}
+	return guild + "/" + id
+}
+
+// Returns the key the player is stored under, see PlayerKey
+func (p *Player) Key() string {
+	return PlayerKey(p.Guild, p.Id)
+}
+
+// Returns true if the player hasn't done anything yet, p has to be locked
+func (p *Player) Fresh() bool {
+	return p.XP == 0 && p.Money == 0 && p.Wins == 0 && p.Losses == 0 && len(p.Inventory) == 0 && p.UsedAttributePoints() == 0
 }
 
 func NewPlayer(user *discordgo.User) *Player {
@@ -138,9 +397,11 @@ func GetXPForLevel(level int) int {
 	return (level - 1) * 10
 }
 
+var ErrInventorySlotNotFound = NewLocaleError("inventory.slot_not_found")
+
 func (p *Player) EquipItem(invSlot int, eqSlot EquipmentSlot) error {
 	if invSlot >= len(p.Inventory) {
-		return errors.New("That inventory slot does not exist, check with the inventory command")
+		return ErrInventorySlotNotFound
 	}
 
 	for _, v := range p.Inventory {
@@ -177,24 +438,67 @@ func (p *Player) BaseMissChance() float32 {
 	return GetMissChance(float32(GetLevelFromXP(p.XP) + p.Attributes.Get(AttributeAgility)))
 }
 
-func (p *Player) GetPrettyDiscordStats() string {
+// Returns the players stats as text in language code, see StatsCard
+func (p *Player) GetPrettyDiscordStats(code string) string {
+	card := p.StatsCard(code)
+	card.Title = ""
+	return TextRenderer{}.Text(card)
+}
+
+func (p *Player) StatsCard(code string) *Card {
 	level := GetLevelFromXP(p.XP)
 	next := GetXPForLevel(level+1) - GetXPForLevel(level)
 	curXp := p.XP - GetXPForLevel(level)
 
 	// General info
-	general := fmt.Sprintf(" - Level: %d\n - Attribute points: %d\n - XP: %d (%d)\n - Money %d$\n - Wins: %d\n - Losses: %d",
-		GetLevelFromXP(p.XP), p.AvailableAttributePoints(), curXp, next, p.Money, p.Wins, p.Losses)
+	general := T(code, "stats.general", GetLevelFromXP(p.XP), p.AvailableAttributePoints(), curXp, next, p.Money, p.Wins, p.Losses)
 
 	// Create a battleplayer since that manages item stats for us
 	bp := NewBattlePlayer(p)
 	bp.Init(nil, nil)
 
-	attributes := fmt.Sprintf(" - Strength: %d (+%d) (increases damage)\n - Stamina: %d(+%d) (increases health)\n - Agility: %d (+%d) (increases dodge chance, decreases miss chance)",
+	attributes := T(code, "stats.attributes",
 		p.Attributes.Get(AttributeStrength), bp.Attributes.Get(AttributeStrength), p.Attributes.Get(AttributeStamina), bp.Attributes.Get(AttributeStamina), p.Attributes.Get(AttributeAgility), bp.Attributes.Get(AttributeAgility))
 
-	stats := fmt.Sprintf(" - Health: %.2f\n - Damage %.2f\n - Dodge Chance: %.2f%%\n - Miss Chance: %.2f%%",
-		bp.MaxHealth(), bp.Damage(), bp.DodgeChance(), bp.MissChance())
+	stats := T(code, "stats.stats", bp.MaxHealth(), bp.Damage(), bp.DodgeChance(), bp.MissChance())
+
+	card := &Card{
+		Title: T(code, "stats.title", p.Name),
+		Color: ColorStats,
+	}
+	card.AddField(T(code, "stats.general.title"), general, false)
+	card.AddField(T(code, "stats.attributes.title"), attributes, false)
+	card.AddField(T(code, "stats.stats.title"), stats, false)
+	return card
+}
+
+// Returns the header and one line per item of the inventory, for a Paginator
+func (p *Player) InventoryPages(code string) (*Card, []string) {
+	card := &Card{
+		Title: T(code, "inventory.title"),
+		Color: ColorItem,
+	}
+
+	if len(p.Inventory) < 1 {
+		card.Description = T(code, "inventory.empty")
+		return card, nil
+	}
+
+	rows := make([]string, 0, len(p.Inventory))
+	for k, v := range p.Inventory {
+		row := fmt.Sprintf("[%d]", k)
+		itemType := GetItemTypeById(v.Id)
+		if itemType == nil {
+			log.Println("Encountered unknown item id", v.Id, "User:", p.Id)
+			rows = append(rows, row+" - "+T(code, "inventory.unknown_item"))
+			continue
+		}
+		row += fmt.Sprintf(" - %s (id: %d) - %s", itemType.LocalName(code), itemType.Id, itemType.LocalDescription(code))
+		if v.EquipmentSlot != EquipmentSlotNone {
+			row += " " + T(code, "inventory.equipped", v.EquipmentSlot.LocalName(code))
+		}
+		rows = append(rows, row)
+	}
 
-	return general + "\n\n" + attributes + "\n\n" + stats
+	return card, rows
 }
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlayerManagerStop(t *testing.T) {
+	store, err := OpenJSONStore(filepath.Join(t.TempDir(), "players.json"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &PlayerManager{Store: store}
+
+	done := make(chan bool)
+	go func() {
+		pm.Run()
+		close(done)
+	}()
+
+	pm.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after Stop")
+	}
+
+	// Stopping again, or before Run, doesn't block
+	pm.Stop()
+	(&PlayerManager{}).Stop()
+}
+
+func TestPlayerManagerStopRightAfterStart(t *testing.T) {
+	store, err := OpenJSONStore(filepath.Join(t.TempDir(), "players.json"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.PutPlayer(&Player{Id: "101", Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		pm := &PlayerManager{Store: store}
+		pm.Start()
+		pm.Stop()
+
+		// Run either loaded before Stop returned or never will
+		pm.RLock()
+		loaded := len(pm.Players)
+		pm.RUnlock()
+		time.Sleep(time.Millisecond)
+
+		pm.RLock()
+		later := len(pm.Players)
+		pm.RUnlock()
+		if later != loaded {
+			t.Fatal("players were loaded after Stop returned")
+		}
+	}
+}
+
+func TestCopyToGuild(t *testing.T) {
+	old := Ledger
+	Ledger = newTestLedger(t)
+	defer func() { Ledger = old }()
+
+	alice := &Player{Id: "1", Name: "alice", Money: 50, XP: 20, Inventory: []*PlayerItem{{Id: 1, EquipmentSlot: EquipmentSlotHead}, {Id: 2}}}
+	bob := &Player{Id: "2", Name: "bob", Money: 10}
+	freshBob := &Player{Id: "2", Guild: "9", Name: "bob"}
+	carol := &Player{Id: "3", Name: "carol", Money: 30}
+	playedCarol := &Player{Id: "3", Guild: "9", Name: "carol", Money: 5}
+	withTestPlayers(t, alice, bob, freshBob, carol, playedCarol)
+
+	aliceBefore, err := json.Marshal(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Players.CopyToGuild("9", "owner")
+	if err != nil {
+		t.Fatal("CopyToGuild:", err)
+	}
+	if n != 2 {
+		t.Errorf("copied %d players, want alice and bob", n)
+	}
+
+	// The source is unchanged, also by changes to the copy
+	copied := Players.GetPlayer("9", "1")
+	if copied == nil || copied == alice {
+		t.Fatal("alice wasn't copied")
+	}
+	copied.Inventory[0].EquipmentSlot = EquipmentSlotNone
+	copied.Money -= 5
+
+	aliceAfter, err := json.Marshal(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(aliceBefore, aliceAfter) {
+		t.Errorf("copying changed the global player from %s to %s", aliceBefore, aliceAfter)
+	}
+
+	if copied.Money != 45 || copied.XP != 20 || len(copied.Inventory) != 2 || copied.Inventory[1].Id != 2 {
+		t.Errorf("alice was copied as %d$, %d XP and %d items", copied.Money+5, copied.XP, len(copied.Inventory))
+	}
+
+	// Fresh profiles are updated in place, played ones are kept
+	if Players.GetPlayer("9", "2") != freshBob || freshBob.Money != 10 {
+		t.Errorf("the fresh server profile of bob has %d$, want 10$", freshBob.Money)
+	}
+	if playedCarol.Money != 5 {
+		t.Errorf("the played server profile of carol was replaced, it has %d$", playedCarol.Money)
+	}
+
+	// The ledger records what the copy started with
+	history, err := Ledger.PlayerHistory(copied)
+	if err != nil {
+		t.Fatal("PlayerHistory:", err)
+	}
+	if len(history) != 1 || history[0].Reason != ReasonCopy || history[0].Actor != "owner" {
+		t.Fatalf("got history %v, want one copy by owner", history)
+	}
+	money, items := 0, 0
+	for _, v := range history[0].Changes {
+		money += v.Money
+		items += v.ItemCount
+	}
+	if money != 50 || items != 2 {
+		t.Errorf("the copy was recorded as %d$ and %d items, want 50$ and 2 items", money, items)
+	}
+
+	history, err = Ledger.PlayerHistory(alice)
+	if err != nil || len(history) != 0 {
+		t.Errorf("the global player has history %v, %v, want none", history, err)
+	}
+}
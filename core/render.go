@@ -0,0 +1,178 @@
+package core
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ColorStats  = 0x3498db
+	ColorItem   = 0xf1c40f
+	ColorBattle = 0xe74c3c
+
+	// Discord embed limits
+	maxEmbedDescription = 4096
+	maxEmbedFieldValue  = 1024
+	maxEmbedFields      = 25
+)
+
+// Card is structured output, rendered into either an embed or plain text depending on the transport
+type Card struct {
+	Title       string
+	Description string
+	Color       int
+	Thumbnail   string
+	Fields      []*CardField
+	Footer      string
+}
+
+type CardField struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+func (c *Card) AddField(name, value string, inline bool) *Card {
+	c.Fields = append(c.Fields, &CardField{Name: name, Value: value, Inline: inline})
+	return c
+}
+
+// Renderer turns cards into messages
+type Renderer interface {
+	Render(card *Card) *discordgo.MessageSend
+}
+
+// EmbedRenderer renders cards as discord embeds
+type EmbedRenderer struct{}
+
+func (e EmbedRenderer) Render(card *Card) *discordgo.MessageSend {
+	embed := &discordgo.MessageEmbed{
+		Title:       card.Title,
+		Description: truncateLines(card.Description, maxEmbedDescription),
+		Color:       card.Color,
+	}
+
+	if card.Thumbnail != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: card.Thumbnail}
+	}
+
+	if card.Footer != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: card.Footer}
+	}
+
+	for k, v := range card.Fields {
+		if k >= maxEmbedFields {
+			break
+		}
+
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   v.Name,
+			Value:  truncateLines(v.Value, maxEmbedFieldValue),
+			Inline: v.Inline,
+		})
+	}
+
+	return &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	}
+}
+
+// TextRenderer renders cards as markdown text, for transports without embeds
+type TextRenderer struct{}
+
+func (t TextRenderer) Render(card *Card) *discordgo.MessageSend {
+	return &discordgo.MessageSend{
+		Content: t.Text(card),
+	}
+}
+
+func (t TextRenderer) Text(card *Card) string {
+	sections := make([]string, 0, len(card.Fields)+3)
+
+	header := ""
+	if card.Title != "" {
+		header = "**" + card.Title + "**"
+	}
+	if card.Description != "" {
+		if header != "" {
+			header += "\n"
+		}
+		header += strings.TrimRight(card.Description, "\n")
+	}
+	if header != "" {
+		sections = append(sections, header)
+	}
+
+	for k := 0; k < len(card.Fields); k++ {
+		field := card.Fields[k]
+
+		// Inline fields go on one line each
+		if field.Inline {
+			lines := ""
+			for ; k < len(card.Fields) && card.Fields[k].Inline; k++ {
+				lines += " - " + card.Fields[k].Name + ": " + card.Fields[k].Value + "\n"
+			}
+			k--
+			sections = append(sections, strings.TrimSuffix(lines, "\n"))
+			continue
+		}
+
+		sections = append(sections, "**"+field.Name+"**\n"+field.Value)
+	}
+
+	if card.Footer != "" {
+		sections = append(sections, "*"+card.Footer+"*")
+	}
+
+	return strings.Join(sections, "\n\n")
+}
+
+// Sends a card using the transports renderer
+func SendCard(channel string, card *Card) {
+	err := sendCard(channel, card)
+	if err != nil {
+		log.Println("Error sending card:", err)
+	}
+}
+
+func sendCard(channel string, card *Card) error {
+	if transport == nil {
+		return ErrNoTransport
+	}
+
+	msg := transport.Renderer().Render(card)
+	if len(msg.Embeds) < 1 {
+		// Plain text may be too long for one message, which SendMessage handles
+		_, err := transport.SendMessage(channel, msg.Content)
+		return err
+	}
+
+	_, err := transport.SendComplex(channel, msg)
+	return err
+}
+
+// Removes lines from the start of s until it fits within max characters
+func truncateLines(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+
+	const marker = "...\n"
+	for len(s)+len(marker) > max {
+		index := strings.Index(s, "\n")
+		if index == -1 {
+			// One long line, cut it at a rune boundary
+			start := len(s) - (max - len(marker))
+			for start < len(s) && !utf8.RuneStart(s[start]) {
+				start++
+			}
+			s = s[start:]
+			break
+		}
+		s = s[index+1:]
+	}
+
+	return marker + s
+}
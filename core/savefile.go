@@ -0,0 +1,179 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Number of timestamped generations of the players file kept next to it, set with -backups
+var flagBackups int
+
+// Time format in the names of generations, sorts the same as the times
+const generationTimeFormat = "20060102-150405.000"
+
+// The contents of a save file
+type saveFile struct {
+	// Format of Data, 0 for files from before there were versions
+	Version int
+
+	// Hex encoded sha256 of Data
+	Checksum string
+
+	Data json.RawMessage
+}
+
+// Returns data in format version wrapped in a save file with its checksum
+func encodeSaveFile(data []byte, version int) ([]byte, error) {
+	return json.Marshal(&saveFile{
+		Version:  version,
+		Checksum: checksum(data),
+		Data:     data,
+	})
+}
+
+// Returns the data in a save file and its format version after verifying the checksum
+// Files from before there were checksums (just the data) are returned as they are, with version 0
+func decodeSaveFile(file []byte) ([]byte, int, error) {
+	trimmed := bytes.TrimSpace(file)
+	if len(trimmed) < 1 {
+		return nil, 0, fmt.Errorf("empty file")
+	}
+
+	if trimmed[0] != '{' {
+		return trimmed, 0, nil
+	}
+
+	var decoded saveFile
+	err := json.Unmarshal(trimmed, &decoded)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if sum := checksum(decoded.Data); sum != decoded.Checksum {
+		return nil, 0, fmt.Errorf("checksum mismatch, expected %s got %s", decoded.Checksum, sum)
+	}
+	return decoded.Data, decoded.Version, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Reads the save file at path and passes its data and format version to decode
+// Falls back to the newest valid generation if path is missing, its checksum doesn't match or decode fails
+// Returns an error satisfying os.IsNotExist if neither path nor any generations exist
+// A SchemaVersionError from decode is returned right away, older backups would lose the newer data
+func readSaveFile(path string, decode func(data []byte, version int) error) error {
+	candidates := append([]string{path}, Generations(path)...)
+
+	var firstErr error
+	for _, v := range candidates {
+		file, err := ioutil.ReadFile(v)
+		if err == nil {
+			var data []byte
+			var version int
+			data, version, err = decodeSaveFile(file)
+			if err == nil {
+				err = decode(data, version)
+			}
+		}
+
+		var versionErr *SchemaVersionError
+		if errors.As(err, &versionErr) {
+			return fmt.Errorf("%s: %w", v, err)
+		}
+
+		if err == nil {
+			if v != path {
+				log.Printf("Loaded %s from the backup %s, %s was unusable: %s", path, v, path, firstErr)
+			}
+			return nil
+		}
+
+		if os.IsNotExist(err) && v == path {
+			if len(candidates) < 2 {
+				return err
+			}
+		} else {
+			log.Printf("Failed loading %s: %s", v, err)
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return fmt.Errorf("no usable save in %s or its %d backups: %s", path, len(candidates)-1, firstErr)
+}
+
+// Writes data in format version to path as a save file with a checksum, keeping the old file as a timestamped generation
+// Only the newest keep generations are kept
+func writeSaveFile(path string, data []byte, version, keep int) error {
+	encoded, err := encodeSaveFile(data, version)
+	if err != nil {
+		return err
+	}
+
+	if keep > 0 {
+		if _, err := os.Stat(path); err == nil {
+			// The new file is renamed over path, so the generation can share the old files contents
+			err = CopyFile(path, path+"."+time.Now().UTC().Format(generationTimeFormat))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = WriteFileAtomic(path, encoded, 0644)
+	if err != nil {
+		return err
+	}
+
+	return pruneGenerations(path, keep)
+}
+
+// Returns the backups of path, newest first
+// These are the timestamped generations, and path.1 from before there were generations
+func Generations(path string) []string {
+	matches, _ := filepath.Glob(path + ".*")
+
+	out := make([]string, 0, len(matches))
+	for _, v := range matches {
+		if _, err := time.Parse(generationTimeFormat, strings.TrimPrefix(v, path+".")); err == nil {
+			out = append(out, v)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(out)))
+
+	if _, err := os.Stat(path + ".1"); err == nil {
+		out = append(out, path+".1")
+	}
+	return out
+}
+
+// Removes all but the newest keep timestamped generations of path
+func pruneGenerations(path string, keep int) error {
+	generations := Generations(path)
+	for k, v := range generations {
+		if k < keep || v == path+".1" {
+			continue
+		}
+
+		err := os.Remove(v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"log"
+	"sync"
+)
+
+var ErrShuttingDown = NewLocaleError("error.shutting_down")
+
+var shutdown = &shutdownState{}
+
+// Tracks commands, accepted battles and messages in progress so shutting down can wait for them
+type shutdownState struct {
+	sync.Mutex
+	stopping bool
+	running  sync.WaitGroup
+	sending  sync.WaitGroup
+}
+
+// Sends a message in the background, Shutdown waits for it so battle results aren't lost when the bot stops
+func sendAsync(fn func()) {
+	shutdown.sending.Add(1)
+	go func() {
+		defer shutdown.sending.Done()
+		fn()
+	}()
+}
+
+// Rejects every command, including from owners, once the bot is shutting down
+func ShutdownMiddleware(next Handler) Handler {
+	return func(inv *Invocation) error {
+		shutdown.Lock()
+		if shutdown.stopping {
+			shutdown.Unlock()
+			return ErrShuttingDown
+		}
+		shutdown.running.Add(1)
+		shutdown.Unlock()
+
+		defer shutdown.running.Done()
+		return next(inv)
+	}
+}
+
+// Returns true once Shutdown has been called
+func ShuttingDown() bool {
+	shutdown.Lock()
+	defer shutdown.Unlock()
+	return shutdown.stopping
+}
+
+// Stops accepting commands, waits for running commands and battles to finish, cancels pending challenges
+// and then saves the players and guild settings and closes the store and ledger
+func Shutdown() error {
+	shutdown.Lock()
+	shutdown.stopping = true
+	shutdown.Unlock()
+
+	log.Println("Shutting down, waiting for running commands and battles")
+	shutdown.running.Wait()
+
+	log.Println("Finishing battles")
+	Battles.Close()
+
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Stop the periodic saves first, they would write to the closed store
+	Players.Stop()
+
+	if Players.Store != nil {
+		err := Players.Save()
+		if err != nil {
+			log.Println("Failed saving players:", err)
+		}
+		keep(err)
+
+		err = Players.Store.Close()
+		if err != nil {
+			log.Println("Failed closing the store:", err)
+		}
+		keep(err)
+	}
+
+	err := Guilds.Save()
+	if err != nil {
+		log.Println("Failed saving guild settings:", err)
+	}
+	keep(err)
+
+	err = Ledger.Close()
+	if err != nil {
+		log.Println("Failed closing the ledger:", err)
+	}
+	keep(err)
+
+	shutdown.sending.Wait()
+	return firstErr
+}
@@ -0,0 +1,269 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+var (
+	flagStore     string
+	flagStorePath string
+
+	ErrNoStore  = errors.New("No store set")
+	ErrReadOnly = errors.New("The store was opened read only")
+)
+
+// Persists players, the PlayerManager keeps them in memory and writes the changed ones to a Store
+type Store interface {
+	StoreTx
+
+	// Runs fn in a transaction, nothing is stored if fn returns an error
+	Update(fn func(tx StoreTx) error) error
+
+	Close() error
+}
+
+// Reads and writes players, either directly on a store or inside a transaction
+type StoreTx interface {
+	// Returns the player with key (see PlayerKey), nil if it isn't stored
+	GetPlayer(key string) (*Player, error)
+
+	PutPlayer(p *Player) error
+
+	// Returns all stored players
+	ListPlayers() ([]*Player, error)
+}
+
+// Opens the store selected with -store and -storepath
+func OpenConfiguredStore() (Store, error) {
+	return OpenStore(flagStore, flagStorePath)
+}
+
+// Opens a store of kind ("json" or "bolt") at path, an empty path uses the default for the kind
+func OpenStore(kind, path string) (Store, error) {
+	switch kind {
+	case "json", "":
+		if path == "" {
+			path = "players.json"
+		}
+		return OpenJSONStore(path, flagBackups)
+	case "bolt":
+		if path == "" {
+			path = "players.db"
+		}
+		return OpenBoltStore(path)
+	}
+	return nil, fmt.Errorf("Unknown store %q, available stores: json, bolt", kind)
+}
+
+// Opens the store selected with -store and -storepath without changing it, see OpenStoreReadOnly
+func OpenConfiguredStoreReadOnly() (Store, error) {
+	return OpenStoreReadOnly(flagStore, flagStorePath)
+}
+
+// Opens the existing store of kind at path without changing it, for looking at saves and backups
+// Players in an older format are migrated in memory and writing to the store fails
+func OpenStoreReadOnly(kind, path string) (Store, error) {
+	switch kind {
+	case "json", "":
+		if path == "" {
+			path = "players.json"
+		}
+		store, err := OpenJSONStore(path, 0)
+		if err != nil {
+			return nil, err
+		}
+		store.ReadOnly = true
+		return store, nil
+	case "bolt":
+		if path == "" {
+			path = "players.db"
+		}
+		return OpenBoltStoreReadOnly(path)
+	}
+	return nil, fmt.Errorf("Unknown store %q, available stores: json, bolt", kind)
+}
+
+func decodePlayer(data []byte) (*Player, error) {
+	var p *Player
+	err := json.Unmarshal(data, &p)
+	return p, err
+}
+
+// Stores all players in one json file, every transaction rewrites the whole file
+// The file is replaced atomically and the previous versions are kept as timestamped generations
+type JSONStore struct {
+	sync.Mutex
+	Path string
+
+	// Number of old versions of the file to keep
+	Generations int
+
+	// Set by OpenStoreReadOnly, Update fails instead of writing the file
+	ReadOnly bool
+
+	players map[string][]byte
+}
+
+// Opens the json file at path, it's created on the first write if it doesn't exist
+// If the file is damaged the newest valid generation is loaded instead
+func OpenJSONStore(path string, generations int) (*JSONStore, error) {
+	store := &JSONStore{
+		Path:        path,
+		Generations: generations,
+		players:     make(map[string][]byte),
+	}
+
+	err := readSaveFile(path, func(data []byte, version int) error {
+		// An array of players
+		var decoded []json.RawMessage
+		err := json.Unmarshal(data, &decoded)
+		if err != nil {
+			return err
+		}
+
+		players := make(map[string][]byte)
+		for _, v := range decoded {
+			migrated, err := MigratePlayer(v, version)
+			if err != nil {
+				return err
+			}
+
+			var header struct{ Id, Guild string }
+			err = json.Unmarshal(migrated, &header)
+			if err != nil {
+				return err
+			}
+			players[PlayerKey(header.Guild, header.Id)] = migrated
+		}
+		store.players = players
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *JSONStore) GetPlayer(key string) (*Player, error) {
+	s.Lock()
+	defer s.Unlock()
+	return (&jsonTx{store: s}).GetPlayer(key)
+}
+
+func (s *JSONStore) PutPlayer(p *Player) error {
+	return s.Update(func(tx StoreTx) error {
+		return tx.PutPlayer(p)
+	})
+}
+
+func (s *JSONStore) ListPlayers() ([]*Player, error) {
+	s.Lock()
+	defer s.Unlock()
+	return (&jsonTx{store: s}).ListPlayers()
+}
+
+func (s *JSONStore) Update(fn func(tx StoreTx) error) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.ReadOnly {
+		return ErrReadOnly
+	}
+
+	tx := &jsonTx{store: s, pending: make(map[string][]byte)}
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+
+	if len(tx.pending) < 1 {
+		return nil
+	}
+
+	for key, data := range tx.pending {
+		s.players[key] = data
+	}
+	return s.write()
+}
+
+// Writes all players to the file, s has to be locked
+func (s *JSONStore) write() error {
+	keys := make([]string, 0, len(s.players))
+	for key := range s.players {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]json.RawMessage, len(keys))
+	for k, key := range keys {
+		out[k] = s.players[key]
+	}
+
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return writeSaveFile(s.Path, encoded, PlayerSchemaVersion, s.Generations)
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+type jsonTx struct {
+	store   *JSONStore
+	pending map[string][]byte // Nil outside of Update
+}
+
+func (tx *jsonTx) GetPlayer(key string) (*Player, error) {
+	data, ok := tx.pending[key]
+	if !ok {
+		data, ok = tx.store.players[key]
+	}
+	if !ok {
+		return nil, nil
+	}
+	return decodePlayer(data)
+}
+
+func (tx *jsonTx) PutPlayer(p *Player) error {
+	if tx.pending == nil {
+		return fmt.Errorf("JSONStore: PutPlayer outside of a transaction")
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tx.pending[p.Key()] = data
+	return nil
+}
+
+func (tx *jsonTx) ListPlayers() ([]*Player, error) {
+	out := make([]*Player, 0, len(tx.store.players))
+	for key, data := range tx.store.players {
+		if _, ok := tx.pending[key]; ok {
+			continue
+		}
+
+		p, err := decodePlayer(data)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+
+	for _, data := range tx.pending {
+		p, err := decodePlayer(data)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
@@ -0,0 +1,216 @@
+package core
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"strconv"
+	"time"
+)
+
+var (
+	boltPlayersBucket = []byte("players")
+
+	// Holds the player format version under boltVersionKey
+	boltMetaBucket = []byte("meta")
+	boltVersionKey = []byte("version")
+)
+
+// Stores every player under its key (see PlayerKey) in a bbolt database, so saving only writes the changed players
+type BoltStore struct {
+	DB *bbolt.DB
+
+	// The format of the stored players, older players are migrated when they're read
+	// Only below PlayerSchemaVersion for stores opened read only
+	version int
+}
+
+// Opens or creates the bbolt database at path, migrating the players if they're in an older format
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(migrateBolt)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{DB: db, version: PlayerSchemaVersion}, nil
+}
+
+// Opens the existing bbolt database at path without changing it, players in an older format are migrated in memory
+// Writing to the store fails
+func OpenBoltStoreReadOnly(path string) (*BoltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second * 5, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	store := &BoltStore{DB: db}
+	err = db.View(func(tx *bbolt.Tx) error {
+		store.version, err = boltVersion(tx)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Returns the player format version of the database, databases from before there were versions don't have one
+func boltVersion(tx *bbolt.Tx) (int, error) {
+	meta := tx.Bucket(boltMetaBucket)
+	if meta == nil {
+		return 0, nil
+	}
+
+	v := meta.Get(boltVersionKey)
+	if v == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(v))
+	if err != nil {
+		return 0, err
+	}
+	if version > PlayerSchemaVersion {
+		return 0, &SchemaVersionError{Version: version}
+	}
+	return version, nil
+}
+
+// Creates the buckets and migrates all players to PlayerSchemaVersion
+func migrateBolt(tx *bbolt.Tx) error {
+	version, err := boltVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	players, err := tx.CreateBucketIfNotExists(boltPlayersBucket)
+	if err != nil {
+		return err
+	}
+
+	meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+	if err != nil {
+		return err
+	}
+
+	if version < PlayerSchemaVersion {
+		migrated := make(map[string][]byte)
+		err = players.ForEach(func(k, v []byte) error {
+			data, err := MigratePlayer(v, version)
+			if err != nil {
+				return err
+			}
+			migrated[string(k)] = data
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Buckets can't be changed while iterating over them
+		for k, v := range migrated {
+			err = players.Put([]byte(k), v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return meta.Put(boltVersionKey, []byte(strconv.Itoa(PlayerSchemaVersion)))
+}
+
+func (s *BoltStore) GetPlayer(key string) (p *Player, err error) {
+	err = s.DB.View(func(tx *bbolt.Tx) error {
+		p, err = (&boltTx{tx, s.version}).GetPlayer(key)
+		return err
+	})
+	return
+}
+
+func (s *BoltStore) PutPlayer(p *Player) error {
+	return s.Update(func(tx StoreTx) error {
+		return tx.PutPlayer(p)
+	})
+}
+
+func (s *BoltStore) ListPlayers() (players []*Player, err error) {
+	err = s.DB.View(func(tx *bbolt.Tx) error {
+		players, err = (&boltTx{tx, s.version}).ListPlayers()
+		return err
+	})
+	return
+}
+
+func (s *BoltStore) Update(fn func(tx StoreTx) error) error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		return fn(&boltTx{tx, s.version})
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.DB.Close()
+}
+
+type boltTx struct {
+	tx      *bbolt.Tx
+	version int // See BoltStore.version
+}
+
+// Decodes a stored player, migrating it first if the store is in an older format
+func (b *boltTx) decode(data []byte) (*Player, error) {
+	if b.version < PlayerSchemaVersion {
+		migrated, err := MigratePlayer(data, b.version)
+		if err != nil {
+			return nil, err
+		}
+		data = migrated
+	}
+	return decodePlayer(data)
+}
+
+func (b *boltTx) GetPlayer(key string) (*Player, error) {
+	// Read only stores opened before there were players have no buckets
+	bucket := b.tx.Bucket(boltPlayersBucket)
+	if bucket == nil {
+		return nil, nil
+	}
+
+	data := bucket.Get([]byte(key))
+	if data == nil {
+		return nil, nil
+	}
+	return b.decode(data)
+}
+
+func (b *boltTx) PutPlayer(p *Player) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return b.tx.Bucket(boltPlayersBucket).Put([]byte(p.Key()), data)
+}
+
+func (b *boltTx) ListPlayers() ([]*Player, error) {
+	out := make([]*Player, 0)
+	bucket := b.tx.Bucket(boltPlayersBucket)
+	if bucket == nil {
+		return out, nil
+	}
+
+	err := bucket.ForEach(func(k, v []byte) error {
+		p, err := b.decode(v)
+		if err != nil {
+			return err
+		}
+		out = append(out, p)
+		return nil
+	})
+	return out, err
+}
@@ -0,0 +1,276 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func openTestBoltStore(t *testing.T, path string) *BoltStore {
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal("OpenBoltStore:", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBoltStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "players.db")
+	store := openTestBoltStore(t, path)
+
+	alice := &Player{Id: "101", Name: "alice", Money: 120, XP: 45, Inventory: []*PlayerItem{{Id: 1, EquipmentSlot: EquipmentSlotRightHand}}}
+	serverAlice := &Player{Id: "101", Guild: "9", Name: "alice", Money: 5}
+	for _, v := range []*Player{alice, serverAlice} {
+		err := store.PutPlayer(v)
+		if err != nil {
+			t.Fatal("PutPlayer:", err)
+		}
+	}
+
+	missing, err := store.GetPlayer("102")
+	if err != nil || missing != nil {
+		t.Errorf("got %v, %v for a missing player, want nothing", missing, err)
+	}
+	store.Close()
+
+	reopened := openTestBoltStore(t, path)
+	for _, v := range []*Player{alice, serverAlice} {
+		p, err := reopened.GetPlayer(v.Key())
+		if err != nil || p == nil {
+			t.Fatalf("%s wasn't stored: %v", v.Key(), err)
+		}
+		if !samePlayerData(p, v) {
+			t.Errorf("%s loaded as %+v, want %+v", v.Key(), p, v)
+		}
+	}
+
+	players, err := reopened.ListPlayers()
+	if err != nil {
+		t.Fatal("ListPlayers:", err)
+	}
+	if len(players) != 2 {
+		t.Errorf("got %d players, want 2", len(players))
+	}
+}
+
+func samePlayerData(a, b *Player) bool {
+	dataA, _ := json.Marshal(a)
+	dataB, _ := json.Marshal(b)
+	return bytes.Equal(dataA, dataB)
+}
+
+// Records the keys of the players written in transactions
+type recordingStore struct {
+	Store
+	written []string
+}
+
+type recordingTx struct {
+	StoreTx
+	store *recordingStore
+}
+
+func (s *recordingStore) Update(fn func(tx StoreTx) error) error {
+	return s.Store.Update(func(tx StoreTx) error {
+		return fn(&recordingTx{StoreTx: tx, store: s})
+	})
+}
+
+func (tx *recordingTx) PutPlayer(p *Player) error {
+	tx.store.written = append(tx.store.written, p.Key())
+	return tx.StoreTx.PutPlayer(p)
+}
+
+func TestBoltStoreSavesChangedPlayers(t *testing.T) {
+	bolt := openTestBoltStore(t, filepath.Join(t.TempDir(), "players.db"))
+	for _, v := range []*Player{{Id: "101", Name: "alice"}, {Id: "102", Name: "bob"}, {Id: "103", Name: "carol"}} {
+		err := bolt.PutPlayer(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := &recordingStore{Store: bolt}
+	pm := &PlayerManager{Store: store}
+	err := pm.Load()
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+
+	err = pm.Save()
+	if err != nil {
+		t.Fatal("Save:", err)
+	}
+	if len(store.written) != 0 {
+		t.Errorf("saving unchanged players wrote %v", store.written)
+	}
+
+	bob := pm.GetPlayer("", "102")
+	bob.Lock()
+	bob.Money += 10
+	bob.Unlock()
+	pm.AddPlayer(&Player{Id: "104", Name: "dave"}, true)
+
+	err = pm.Save()
+	if err != nil {
+		t.Fatal("Save:", err)
+	}
+	sort.Strings(store.written)
+	if len(store.written) != 2 || store.written[0] != "102" || store.written[1] != "104" {
+		t.Errorf("saving wrote %v, want 102 and 104", store.written)
+	}
+
+	stored, err := bolt.GetPlayer("102")
+	if err != nil || stored == nil || stored.Money != 10 {
+		t.Errorf("bob was stored as %+v, %v, want 10$", stored, err)
+	}
+}
+
+// Creates a bbolt database at path with the players from the fixture testdata/name in their old format
+// version is stored unless it's 0, databases from before there were versions don't have one
+func writeBoltFixture(t *testing.T, path, name string, version string) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, _, err := decodeSaveFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var players []map[string]interface{}
+	err = json.Unmarshal(decoded, &players)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket(boltPlayersBucket)
+		if err != nil {
+			return err
+		}
+		for _, v := range players {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put([]byte(v["Id"].(string)), data)
+			if err != nil {
+				return err
+			}
+		}
+
+		if version == "" {
+			return nil
+		}
+		meta, err := tx.CreateBucket(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+		return meta.Put(boltVersionKey, []byte(version))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Checks the store has alice from the fixtures, migrated to the current format
+func checkMigratedAlice(t *testing.T, store Store) {
+	alice, err := store.GetPlayer("101")
+	if err != nil || alice == nil {
+		t.Fatalf("alice wasn't loaded: %v", err)
+	}
+	if alice.Name != "alice" || alice.Money != 120 || alice.XP != 45 || alice.Guild != "" {
+		t.Errorf("alice loaded as %s, %d$, %d XP in economy %q, want alice, 120$, 45 XP in the global one", alice.Name, alice.Money, alice.XP, alice.Guild)
+	}
+	if len(alice.Inventory) < 1 || alice.Inventory[0].Id != 1 || alice.Attributes.Get(AttributeStrength) != 2 {
+		t.Errorf("alice lost items or attributes: %+v", alice)
+	}
+
+	players, err := store.ListPlayers()
+	if err != nil {
+		t.Fatal("ListPlayers:", err)
+	}
+	if len(players) != 2 {
+		t.Errorf("got %d players, want 2", len(players))
+	}
+}
+
+func TestBoltStoreMigrate(t *testing.T) {
+	for _, fixture := range []struct{ name, version string }{{"players_v0.json", ""}, {"players_v1.json", "1"}} {
+		path := filepath.Join(t.TempDir(), "players.db")
+		writeBoltFixture(t, path, fixture.name, fixture.version)
+
+		// Reading doesn't change the file
+		before, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		readOnly, err := OpenBoltStoreReadOnly(path)
+		if err != nil {
+			t.Fatalf("%s: OpenBoltStoreReadOnly: %v", fixture.name, err)
+		}
+		checkMigratedAlice(t, readOnly)
+		if err := readOnly.PutPlayer(&Player{Id: "103"}); err == nil {
+			t.Errorf("%s: writing to the read only store didn't fail", fixture.name)
+		}
+		readOnly.Close()
+
+		after, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Errorf("%s: opening read only changed the file", fixture.name)
+		}
+
+		// Opening it normally migrates it in place
+		store := openTestBoltStore(t, path)
+		checkMigratedAlice(t, store)
+		store.Close()
+
+		db, err := bbolt.Open(path, 0600, &bbolt.Options{ReadOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.View(func(tx *bbolt.Tx) error {
+			version, err := boltVersion(tx)
+			if version != PlayerSchemaVersion {
+				t.Errorf("%s: migrated to version %d, want %d", fixture.name, version, PlayerSchemaVersion)
+			}
+			return err
+		})
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBoltStoreNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "players.db")
+	writeBoltFixture(t, path, "players_v1.json", "100")
+
+	for name, open := range map[string]func(string) (*BoltStore, error){"OpenBoltStore": OpenBoltStore, "OpenBoltStoreReadOnly": OpenBoltStoreReadOnly} {
+		store, err := open(path)
+		if err == nil {
+			store.Close()
+		}
+		if _, ok := err.(*SchemaVersionError); !ok {
+			t.Errorf("%s: got error %v, want a SchemaVersionError", name, err)
+		}
+	}
+}
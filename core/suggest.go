@@ -0,0 +1,95 @@
+package core
+
+import (
+	"strings"
+)
+
+// Wraps an error about an unknown name with the closest valid alternative
+type SuggestionError struct {
+	Err        error
+	Suggestion string
+}
+
+func (s *SuggestionError) Error() string {
+	return s.Localize(FallbackLanguage)
+}
+
+func (s *SuggestionError) Localize(code string) string {
+	return T(code, "error.suggestion", LocalizeError(code, s.Err), s.Suggestion)
+}
+
+func (s *SuggestionError) Unwrap() error {
+	return s.Err
+}
+
+// Returns err wrapped in a SuggestionError if any of candidates is close to input, otherwise err
+func WithSuggestion(err error, input string, candidates []string) error {
+	if suggestion, ok := ClosestMatch(input, candidates); ok {
+		return &SuggestionError{Err: err, Suggestion: suggestion}
+	}
+	return err
+}
+
+// Returns the candidate closest to input by edit distance, ignoring case
+// Returns false if none are close enough to be a likely typo
+func ClosestMatch(input string, candidates []string) (string, bool) {
+	input = strings.ToLower(input)
+
+	// Allow roughly one typo per 3 characters
+	maxDistance := len([]rune(input)) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	best := ""
+	bestDistance := maxDistance + 1
+	for _, v := range candidates {
+		distance := EditDistance(input, strings.ToLower(v))
+		if distance < bestDistance {
+			best = v
+			bestDistance = distance
+		}
+	}
+
+	return best, best != ""
+}
+
+// Returns the edit distance between a and b, counting insertions, deletions,
+// substitutions and swapping two adjacent characters as one edit each
+func EditDistance(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	// Only the last two rows are needed for transpositions
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
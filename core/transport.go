@@ -0,0 +1,88 @@
+package core
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"log"
+)
+
+// Transport is everything core needs from the chat service,
+// the discordgo session is one implementation, MemoryTransport another
+type Transport interface {
+	// The user the bot is running as
+	BotUser() *discordgo.User
+
+	// Sends a message to a channel, splitting it up if too long
+	SendMessage(channel, msg string) ([]*discordgo.Message, error)
+
+	// Sends a message with embeds or components
+	SendComplex(channel string, msg *discordgo.MessageSend) (*discordgo.Message, error)
+
+	// The renderer cards sent through this transport should use
+	Renderer() Renderer
+
+	// Replaces the content of an existing message
+	EditMessage(channel, id, msg string) (*discordgo.Message, error)
+
+	// Edits an existing message, including embeds and components
+	EditComplex(edit *discordgo.MessageEdit) (*discordgo.Message, error)
+
+	// Sends a direct message to a user
+	SendDM(userID, msg string) error
+
+	// Looks up a user by id
+	User(id string) (*discordgo.User, error)
+
+	// Looks up a member by username in the guild the channel belongs to
+	FindMember(channel, name string) (*discordgo.User, error)
+
+	// Looks up a member of a guild by user id
+	GuildMember(guildID, userID string) (*discordgo.Member, error)
+
+	// Returns the discord permissions the user has in the channel
+	UserPermissions(userID, channel string) (int64, error)
+}
+
+var (
+	transport Transport
+
+	ErrNoTransport     = errors.New("No transport set")
+	ErrMessageNotFound = errors.New("Message not found")
+)
+
+// Sets the transport core talks through
+// Only safe to call before bot has started
+func SetTransport(t Transport) {
+	transport = t
+}
+
+// Returns the transport core is currently using
+func GetTransport() Transport {
+	return transport
+}
+
+// Simple wrapper for convenience
+func SendMessage(channel, msg string) {
+	if transport == nil {
+		log.Println("Error sending message(s):", ErrNoTransport)
+		return
+	}
+
+	_, err := transport.SendMessage(channel, msg)
+	if err != nil {
+		log.Println("Error sending message(s):", err)
+	}
+}
+
+// Same as SendMessage but for direct messages
+func SendDM(userID, msg string) {
+	if transport == nil {
+		log.Println("Error sending dm:", ErrNoTransport)
+		return
+	}
+
+	err := transport.SendDM(userID, msg)
+	if err != nil {
+		log.Println("Error sending dm:", err)
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/jonas747/dutil"
+	"strings"
+)
+
+// DiscordTransport is the Transport backed by a live discordgo session
+type DiscordTransport struct {
+	Session *discordgo.Session
+}
+
+func NewDiscordTransport(session *discordgo.Session) *DiscordTransport {
+	return &DiscordTransport{
+		Session: session,
+	}
+}
+
+func (d *DiscordTransport) BotUser() *discordgo.User {
+	if d.Session.State == nil {
+		return nil
+	}
+	return d.Session.State.User
+}
+
+func (d *DiscordTransport) SendMessage(channel, msg string) ([]*discordgo.Message, error) {
+	return dutil.SplitSendMessage(d.Session, channel, msg)
+}
+
+func (d *DiscordTransport) SendComplex(channel string, msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	return d.Session.ChannelMessageSendComplex(channel, msg)
+}
+
+func (d *DiscordTransport) Renderer() Renderer {
+	return EmbedRenderer{}
+}
+
+func (d *DiscordTransport) EditMessage(channel, id, msg string) (*discordgo.Message, error) {
+	return d.Session.ChannelMessageEdit(channel, id, msg)
+}
+
+func (d *DiscordTransport) EditComplex(edit *discordgo.MessageEdit) (*discordgo.Message, error) {
+	return d.Session.ChannelMessageEditComplex(edit)
+}
+
+func (d *DiscordTransport) SendDM(userID, msg string) error {
+	channel, err := d.Session.UserChannelCreate(userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = dutil.SplitSendMessage(d.Session, channel.ID, msg)
+	return err
+}
+
+func (d *DiscordTransport) User(id string) (*discordgo.User, error) {
+	return d.Session.User(id)
+}
+
+func (d *DiscordTransport) FindMember(channel, name string) (*discordgo.User, error) {
+	state := d.Session.State
+
+	c, err := state.Channel(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	guild, err := state.Guild(c.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	state.RLock()
+	defer state.RUnlock()
+	for _, v := range guild.Members {
+		if strings.EqualFold(name, v.User.Username) {
+			return v.User, nil
+		}
+	}
+
+	return nil, ErrDiscordUserNotFound
+}
+
+func (d *DiscordTransport) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	member, err := d.Session.State.Member(guildID, userID)
+	if err == nil {
+		return member, nil
+	}
+
+	// Not in state, ask discord
+	return d.Session.GuildMember(guildID, userID)
+}
+
+func (d *DiscordTransport) UserPermissions(userID, channel string) (int64, error) {
+	perms, err := d.Session.State.UserChannelPermissions(userID, channel)
+	if err == nil {
+		return perms, nil
+	}
+
+	// Not in state, ask discord
+	return d.Session.UserChannelPermissions(userID, channel)
+}
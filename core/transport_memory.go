@@ -0,0 +1,196 @@
+package core
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryTransport is a Transport that never leaves the process
+// It records everything sent through it, useful for tests and tooling
+type MemoryTransport struct {
+	sync.RWMutex
+
+	Bot      *discordgo.User
+	Users    []*discordgo.User
+	Messages []*discordgo.Message
+
+	// Discord permissions by user id, same in every channel
+	Permissions map[string]int64
+
+	// Role ids by user id, same in every guild
+	Roles map[string][]string
+
+	// Render cards as embeds instead of text
+	Embeds bool
+
+	// Called for every message sent or edited, if set
+	OnMessage func(msg *discordgo.Message, edit bool)
+
+	lastID int
+}
+
+func NewMemoryTransport(bot *discordgo.User) *MemoryTransport {
+	return &MemoryTransport{
+		Bot:         bot,
+		Permissions: make(map[string]int64),
+		Roles:       make(map[string][]string),
+	}
+}
+
+// Adds a user that can be found with User and FindMember
+func (mt *MemoryTransport) AddUser(user *discordgo.User) {
+	mt.Lock()
+	mt.Users = append(mt.Users, user)
+	mt.Unlock()
+}
+
+// Returns all messages sent to channel so far
+func (mt *MemoryTransport) ChannelMessages(channel string) []*discordgo.Message {
+	mt.RLock()
+	defer mt.RUnlock()
+
+	out := make([]*discordgo.Message, 0)
+	for _, v := range mt.Messages {
+		if v.ChannelID == channel {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Removes all recorded messages
+func (mt *MemoryTransport) Reset() {
+	mt.Lock()
+	mt.Messages = nil
+	mt.Unlock()
+}
+
+func (mt *MemoryTransport) BotUser() *discordgo.User {
+	return mt.Bot
+}
+
+func (mt *MemoryTransport) SendMessage(channel, msg string) ([]*discordgo.Message, error) {
+	message, err := mt.SendComplex(channel, &discordgo.MessageSend{Content: msg})
+	if err != nil {
+		return nil, err
+	}
+	return []*discordgo.Message{message}, nil
+}
+
+func (mt *MemoryTransport) SendComplex(channel string, msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	mt.Lock()
+	mt.lastID++
+	message := &discordgo.Message{
+		ID:         strconv.Itoa(mt.lastID),
+		ChannelID:  channel,
+		Content:    msg.Content,
+		Embeds:     msg.Embeds,
+		Components: msg.Components,
+		Author:     mt.Bot,
+	}
+	mt.Messages = append(mt.Messages, message)
+	onMessage := mt.OnMessage
+	mt.Unlock()
+
+	if onMessage != nil {
+		onMessage(message, false)
+	}
+	return message, nil
+}
+
+func (mt *MemoryTransport) Renderer() Renderer {
+	if mt.Embeds {
+		return EmbedRenderer{}
+	}
+	return TextRenderer{}
+}
+
+func (mt *MemoryTransport) EditMessage(channel, id, msg string) (*discordgo.Message, error) {
+	return mt.EditComplex(discordgo.NewMessageEdit(channel, id).SetContent(msg))
+}
+
+func (mt *MemoryTransport) EditComplex(edit *discordgo.MessageEdit) (*discordgo.Message, error) {
+	mt.Lock()
+	var message *discordgo.Message
+	for _, v := range mt.Messages {
+		if v.ChannelID == edit.Channel && v.ID == edit.ID {
+			message = v
+			break
+		}
+	}
+	if message == nil {
+		mt.Unlock()
+		return nil, ErrMessageNotFound
+	}
+
+	if edit.Content != nil {
+		message.Content = *edit.Content
+	}
+	if edit.Embeds != nil {
+		message.Embeds = *edit.Embeds
+	}
+	if edit.Components != nil {
+		message.Components = *edit.Components
+	}
+	onMessage := mt.OnMessage
+	mt.Unlock()
+
+	if onMessage != nil {
+		onMessage(message, true)
+	}
+	return message, nil
+}
+
+// DMs are recorded as messages to the channel "dm:{userid}"
+func (mt *MemoryTransport) SendDM(userID, msg string) error {
+	_, err := mt.SendMessage("dm:"+userID, msg)
+	return err
+}
+
+func (mt *MemoryTransport) User(id string) (*discordgo.User, error) {
+	mt.RLock()
+	defer mt.RUnlock()
+
+	for _, v := range mt.Users {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+	return nil, ErrDiscordUserNotFound
+}
+
+// All users are treated as members of every channel
+func (mt *MemoryTransport) FindMember(channel, name string) (*discordgo.User, error) {
+	mt.RLock()
+	defer mt.RUnlock()
+
+	for _, v := range mt.Users {
+		if strings.EqualFold(name, v.Username) {
+			return v, nil
+		}
+	}
+	return nil, ErrDiscordUserNotFound
+}
+
+func (mt *MemoryTransport) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	user, err := mt.User(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	mt.RLock()
+	defer mt.RUnlock()
+	return &discordgo.Member{
+		GuildID: guildID,
+		User:    user,
+		Roles:   mt.Roles[userID],
+	}, nil
+}
+
+func (mt *MemoryTransport) UserPermissions(userID, channel string) (int64, error) {
+	mt.RLock()
+	defer mt.RUnlock()
+	return mt.Permissions[userID], nil
+}
@@ -2,10 +2,10 @@ package core
 
 import (
 	"fmt"
-	"github.com/jonas747/dutil"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 // CopyFile copies a file from src to dst. If src and dst files exist, and are
@@ -68,10 +68,41 @@ func copyFileContents(src, dst string) (err error) {
 	return
 }
 
-// Simple wrapper for convenience
-func SendMessage(channel, msg string) {
-	_, err := dutil.SplitSendMessage(dgo, channel, msg)
+// WriteFileAtomic writes data to a temporary file next to path, syncs it to disk and renames it
+// over path, so path always has either the old or the new contents even if the bot crashes
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
 	if err != nil {
-		log.Println("Error sending message(s):", err)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return
+	}
+
+	// Sync the directory so the rename itself survives a crash
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return
 	}
+	defer dir.Close()
+	return dir.Sync()
 }
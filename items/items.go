@@ -65,7 +65,7 @@ var ItemTypes = []*core.ItemType{
 					Trigger: EffectTriggerTurn,
 					Apply: func(sender *core.BattlePlayer, receiver *core.BattlePlayer, battle *core.Battle) {
 						if battle.CurTurn%2 == 0 {
-							battle.DealDamage(sender, receiver, -2, "Holy Torso")
+							battle.DealDamage(sender, receiver, -2, battle.T("source.holy_torso"))
 						}
 					},
 				},
@@ -88,7 +88,7 @@ var ItemTypes = []*core.ItemType{
 					Target:  TargetOpponent,
 					Trigger: EffectTriggerAttack,
 					Apply: func(sender *core.BattlePlayer, receiver *core.BattlePlayer, battle *core.Battle) {
-						battle.DealDamage(sender, receiver, -10, "Flowers")
+						battle.DealDamage(sender, receiver, -10, battle.T("source.flowers"))
 					},
 				},
 			},
@@ -107,7 +107,7 @@ var ItemTypes = []*core.ItemType{
 					Target:  TargetOpponent,
 					Trigger: EffectTriggerAttack,
 					Apply: func(sender *core.BattlePlayer, receiver *core.BattlePlayer, battle *core.Battle) {
-						battle.Stun(sender, receiver, 4, "Paper airplane")
+						battle.Stun(sender, receiver, 4, battle.T("source.paper_airplane"))
 					},
 				},
 			},
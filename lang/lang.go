@@ -0,0 +1,10 @@
+// Package lang holds the message catalogs shipped with the bot, one json file per language named after its code
+// See the translating section in the readme for the format
+package lang
+
+import (
+	"embed"
+)
+
+//go:embed *.json
+var Files embed.FS